@@ -14,15 +14,21 @@ import (
 	"github.com/AdmiralBulldogTv/VodApi/src/configure"
 	"github.com/AdmiralBulldogTv/VodApi/src/global"
 	"github.com/AdmiralBulldogTv/VodApi/src/health"
+	"github.com/AdmiralBulldogTv/VodApi/src/migrations"
 	"github.com/AdmiralBulldogTv/VodApi/src/monitoring"
+	"github.com/AdmiralBulldogTv/VodApi/src/outbox"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/prometheus"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/redis"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/rmq"
+	"github.com/AdmiralBulldogTv/VodApi/src/transcode"
+	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
 	"github.com/AdmiralBulldogTv/VodApi/src/twitch_chat"
 
 	"github.com/bugsnag/panicwrap"
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -89,12 +95,73 @@ func main() {
 	}
 
 	{
+		gCtx.Inst().Twitch = twitch.NewClient(twitch.Options{
+			ClientID:     gCtx.Config().Twitch.ClientID,
+			ClientSecret: gCtx.Config().Twitch.ClientSecret,
+			RefreshToken: gCtx.Config().Twitch.EventSub.RefreshToken,
+			BaseURL:      gCtx.Config().Twitch.HelixURL,
+			AuthURL:      gCtx.Config().Twitch.AuthURL,
+			Redis:        gCtx.Inst().Redis,
+		})
+	}
+
+	{
+		indexes := []mongo.IndexRef{{
+			Collection: mongo.CollectionNameEventSubs,
+			Index: mongo.IndexModel{
+				Keys:    bson.D{{Key: "type", Value: 1}, {Key: "broadcaster_user_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		}, {
+			Collection: mongo.CollectionNameUsers,
+			Index: mongo.IndexModel{
+				Keys: bson.D{{Key: "hashed_stream_key.hash", Value: 1}},
+				// revoked keys have an empty hash
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+					"hashed_stream_key.hash": bson.M{"$gt": ""},
+				}),
+			},
+		}, {
+			Collection: mongo.CollectionNameStreamKeyAudit,
+			Index: mongo.IndexModel{
+				Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: -1}},
+			},
+		}, {
+			Collection: mongo.CollectionNameVodEvents,
+			Index: mongo.IndexModel{
+				Keys: bson.D{{Key: "vod_id", Value: 1}, {Key: "timestamp", Value: 1}},
+			},
+		}, {
+			Collection: mongo.CollectionNameOutbox,
+			Index: mongo.IndexModel{
+				Keys: bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}, {Key: "_id", Value: 1}},
+			},
+		}, {
+			Collection: mongo.CollectionNameOutbox,
+			Index: mongo.IndexModel{
+				Keys: bson.D{{Key: "sent_at", Value: 1}},
+				// pending messages have no sent_at and are kept
+				Options: options.Index().SetExpireAfterSeconds(int32((time.Hour * 24 * 7).Seconds())),
+			},
+		}, {
+			Collection: mongo.CollectionNameChat,
+			Index: mongo.IndexModel{
+				Keys: bson.D{{Key: "twitch.id", Value: 1}},
+				// every ingester inserts the messages it reads, the index keeps one copy
+				Options: options.Index().SetUnique(true),
+			},
+		}}
+		// migrations may have to clean up the data an index is built on first
+		if gCtx.Config().Migrate != "" {
+			indexes = nil
+		}
+
 		ctx, cancel := context.WithTimeout(gCtx, time.Second*15)
 		mongoInst, err := mongo.New(ctx, mongo.SetupOptions{
 			URI:      gCtx.Config().Mongo.URI,
 			Database: gCtx.Config().Mongo.Database,
 			Direct:   gCtx.Config().Mongo.Direct,
-			Indexes:  []mongo.IndexRef{},
+			Indexes:  indexes,
 		})
 		cancel()
 		if err != nil {
@@ -104,6 +171,15 @@ func main() {
 		gCtx.Inst().Mongo = mongoInst
 	}
 
+	if gCtx.Config().Migrate != "" {
+		if err := migrations.Run(gCtx, gCtx.Config().Migrate); err != nil {
+			logrus.WithError(err).Fatal("migration failed")
+		}
+
+		logrus.Info("migration complete")
+		os.Exit(0)
+	}
+
 	{
 		gCtx.Inst().Prometheus = prometheus.New(prometheus.SetupOptions{
 			Labels: prometheus.LabelsFromKeyValue(gCtx.Config().Monitoring.Labels),
@@ -111,11 +187,12 @@ func main() {
 	}
 
 	{
-		ctx, cancel := context.WithTimeout(gCtx, time.Second*15)
-		rmqInst, err := rmq.New(ctx, rmq.SetupOptions{
-			URI: gCtx.Config().RMQ.URI,
+		rmqInst, err := rmq.New(gCtx, rmq.SetupOptions{
+			URI:        gCtx.Config().RMQ.URI,
+			Prefetch:   gCtx.Config().RMQ.Prefetch,
+			PoolSize:   gCtx.Config().RMQ.ChannelPoolSize,
+			Prometheus: gCtx.Inst().Prometheus,
 		})
-		cancel()
 		if err != nil {
 			logrus.WithError(err).Fatal("failed to connect to rmq")
 		}
@@ -123,7 +200,7 @@ func main() {
 		gCtx.Inst().RMQ = rmqInst
 	}
 
-	dones := []<-chan struct{}{api.New(gCtx)}
+	dones := []<-chan struct{}{api.New(gCtx), transcode.New(gCtx), outbox.New(gCtx)}
 	if gCtx.Config().Health.Enabled {
 		dones = append(dones, health.New(gCtx))
 	}
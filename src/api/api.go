@@ -1,6 +1,7 @@
 package api
 
 import (
+	"strings"
 	"time"
 
 	"github.com/AdmiralBulldogTv/VodApi/src/global"
@@ -16,7 +17,19 @@ var json = jsoniter.ConfigCompatibleWithStandardLibrary
 func New(gCtx global.Context) <-chan struct{} {
 	done := make(chan struct{})
 	gql := GqlHandler(gCtx)
-	webhookTwitch := WebhookTwitchHandler(gCtx)
+	chapters := ChaptersHandler(gCtx)
+	media := MediaHandler(gCtx)
+	rtmp := RTMPHandler(gCtx)
+
+	var (
+		webhookTwitch func(ctx *fasthttp.RequestCtx)
+		eventSubDone  <-chan struct{}
+	)
+	if gCtx.Config().Twitch.EventSub.Transport == "websocket" {
+		eventSubDone = EventSubWebsocket(gCtx)
+	} else {
+		webhookTwitch = WebhookTwitchHandler(gCtx)
+	}
 
 	server := fasthttp.Server{
 		Handler: func(ctx *fasthttp.RequestCtx) {
@@ -40,8 +53,16 @@ func New(gCtx global.Context) <-chan struct{} {
 
 			if path == "/gql" {
 				gql(ctx)
-			} else if path == "/twitch/webhook" {
+			} else if path == "/twitch/webhook" && webhookTwitch != nil {
 				webhookTwitch(ctx)
+			} else if strings.HasPrefix(path, "/rtmp/") {
+				rtmp(ctx)
+			} else if strings.HasPrefix(path, "/vods/") {
+				if strings.Contains(path, "/chapters.") {
+					chapters(ctx)
+				} else {
+					media(ctx)
+				}
 			} else {
 				ctx.SetStatusCode(fasthttp.StatusNotFound)
 			}
@@ -60,6 +81,9 @@ func New(gCtx global.Context) <-chan struct{} {
 	go func() {
 		<-gCtx.Done()
 		_ = server.Shutdown()
+		if eventSubDone != nil {
+			<-eventSubDone
+		}
 		close(done)
 	}()
 
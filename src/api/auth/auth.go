@@ -2,12 +2,83 @@ package auth
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
 
 	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
 	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func For(ctx context.Context) *structures.User {
 	raw, _ := ctx.Value(helpers.UserKey).(*structures.User)
 	return raw
 }
+
+// OwnerOrAdmin is true for the admin token and the user with the id.
+func OwnerOrAdmin(ctx context.Context, userID primitive.ObjectID) bool {
+	if admin, _ := ctx.Value(helpers.AdminKey).(bool); admin {
+		return true
+	}
+
+	user := For(ctx)
+	return user != nil && user.ID == userID
+}
+
+// Authenticate returns the user a twitch access token belongs to.
+// Tokens are validated with twitch once and then remembered for a few minutes.
+func Authenticate(gCtx global.Context, ctx context.Context, token string) (*structures.User, error) {
+	h := sha256.Sum256([]byte(token))
+	key := "twitch-auth-tokens:" + hex.EncodeToString(h[:])
+
+	var twitchID string
+	if v, err := gCtx.Inst().Redis.Get(ctx, key); err == nil {
+		twitchID = v.(string)
+	} else {
+		if err != redis.Nil {
+			logrus.Error("failed to query redis: ", err)
+		}
+
+		validation, err := gCtx.Inst().Twitch.ValidateToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		// tokens of other apps are not meant for us
+		if validation.ClientID != gCtx.Config().Twitch.ClientID || validation.UserID == "" {
+			return nil, helpers.ErrUnauthorized
+		}
+
+		ttl := time.Minute * 5
+		if expires := time.Second * time.Duration(validation.ExpiresIn); expires < ttl {
+			ttl = expires
+		}
+
+		twitchID = validation.UserID
+		if ttl > 0 {
+			if err := gCtx.Inst().Redis.SetEX(ctx, key, twitchID, ttl); err != nil {
+				logrus.Error("failed to store token in redis: ", err)
+			}
+		}
+	}
+
+	user := &structures.User{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{
+		"twitch.id": twitchID,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(user)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// resolveCategory looks up a category through helix and stores it, it never fails and falls back to what the event told us.
+func resolveCategory(gCtx global.Context, ctx context.Context, id string, name string) structures.Category {
+	if id == "" || id == structures.CategoryUnknownID {
+		return structures.Category{
+			ID:        structures.CategoryUnknownID,
+			Name:      structures.CategoryUnknownName,
+			BoxArtURL: structures.CategoryUnknownBoxArtURL,
+		}
+	}
+
+	category := structures.Category{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameCategories).FindOne(ctx, bson.M{
+		"_id": id,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&category)
+	}
+	if err == nil && time.Since(category.UpdatedAt) < time.Hour*24*7 {
+		return category
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		logrus.Error("failed to fetch category: ", err)
+	}
+
+	games, err := gCtx.Inst().Twitch.GetGames(ctx, id)
+	if err != nil || len(games) == 0 {
+		if err != nil {
+			logrus.WithField("id", id).Error("failed to get game: ", err)
+		}
+
+		// a stale category is still better than a made up one, only helix knows the box art of a category
+		if category.ID != "" {
+			return category
+		}
+
+		if name == "" {
+			name = structures.CategoryUnknownName
+		}
+
+		return structures.Category{
+			ID:        id,
+			Name:      name,
+			BoxArtURL: structures.CategoryUnknownBoxArtURL,
+		}
+	}
+
+	category = structures.Category{
+		ID:        games[0].ID,
+		Name:      games[0].Name,
+		BoxArtURL: games[0].BoxArtURL,
+		UpdatedAt: time.Now(),
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameCategories).ReplaceOne(ctx, bson.M{
+		"_id": category.ID,
+	}, category, options.Replace().SetUpsert(true)); err != nil {
+		logrus.Error("failed to store category: ", err)
+	}
+
+	return category
+}
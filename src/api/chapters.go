@@ -0,0 +1,66 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChaptersHandler serves the chapters of a vod on /vods/<id>/chapters.vtt and /vods/<id>/chapters.ffmetadata.
+func ChaptersHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !ctx.IsGet() {
+			ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			return
+		}
+
+		splits := strings.Split(strings.TrimPrefix(utils.B2S(ctx.Path()), "/vods/"), "/")
+		if len(splits) != 2 {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+
+		vID, err := primitive.ObjectIDFromHex(splits[0])
+		if err != nil {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+
+		vod := structures.Vod{}
+		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOne(ctx, bson.M{
+			"_id":            vID,
+			"vod_visibility": structures.VodVisibilityPublic,
+		})
+		err = res.Err()
+		if err == nil {
+			err = res.Decode(&vod)
+		}
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+			} else {
+				logrus.Error("failed to fetch vod: ", err)
+				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			}
+			return
+		}
+
+		switch splits[1] {
+		case "chapters.vtt":
+			ctx.SetContentType("text/vtt; charset=utf-8")
+			ctx.SetBodyString(vod.Chapters().WebVTT())
+		case "chapters.ffmetadata":
+			ctx.SetContentType("text/plain; charset=utf-8")
+			ctx.SetBodyString(vod.Chapters().FFMetadata(vod.Title))
+		default:
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+	}
+}
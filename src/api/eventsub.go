@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eventSubTypes are the subscriptions we keep for every user.
+var eventSubTypes = []string{"channel.update", "stream.online", "stream.offline"}
+
+// eventSubRecreate are the revocation reasons we can recover from by subscribing again.
+var eventSubRecreate = map[string]bool{
+	"notification_failures_exceeded": true,
+}
+
+// webhookTransport delivers events to our webhook endpoint.
+func webhookTransport(gCtx global.Context) twitch.EventSubTransport {
+	return twitch.EventSubTransport{
+		Method:   "webhook",
+		Callback: gCtx.Config().Twitch.Webhook.CallbackURL,
+		Secret:   gCtx.Config().Twitch.Webhook.Secret,
+	}
+}
+
+// createEventSub subscribes to an event for a broadcaster and records the new subscription, it returns the id twitch gave it.
+func createEventSub(gCtx global.Context, ctx context.Context, transport twitch.EventSubTransport, typ string, broadcasterID string) (string, error) {
+	sub, err := gCtx.Inst().Twitch.CreateEventSub(ctx, twitch.EventSubRequest{
+		Type:    typ,
+		Version: "1",
+		Condition: helix.EventSubCondition{
+			BroadcasterUserID: broadcasterID,
+		},
+		Transport: transport,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return sub.ID, recordEventSub(gCtx, ctx, structures.EventSubSubscription{
+		Type:              typ,
+		BroadcasterUserID: broadcasterID,
+		TwitchID:          sub.ID,
+		Status:            sub.Status,
+		Transport:         transport.Method,
+	})
+}
+
+// deleteEventSubRecords removes the records of subscriptions of broadcasters that are not users anymore.
+func deleteEventSubRecords(gCtx global.Context, ctx context.Context, users []structures.User) error {
+	userIDs := make([]string, len(users))
+	for i, v := range users {
+		userIDs[i] = v.Twitch.ID
+	}
+
+	_, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameEventSubs).DeleteMany(ctx, bson.M{
+		"broadcaster_user_id": bson.M{"$nin": userIDs},
+	})
+
+	return err
+}
+
+// eventSubUsers returns the users we keep subscriptions for.
+func eventSubUsers(gCtx global.Context, ctx context.Context) ([]structures.User, error) {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionUsers).Find(ctx, bson.M{})
+	users := []structures.User{}
+	if err == nil {
+		err = cur.All(ctx, &users)
+	}
+
+	return users, err
+}
+
+// markEventSubMessage returns false when the message was already handled, twitch delivers messages at least once.
+func markEventSubMessage(gCtx global.Context, ctx context.Context, id string) (bool, error) {
+	return gCtx.Inst().Redis.SetNX(ctx, fmt.Sprintf("twitch-webhook-events:%s", id), "1", time.Hour*12)
+}
+
+// recordEventSub stores the current state of a subscription, revocation details are kept until the next revocation.
+func recordEventSub(gCtx global.Context, ctx context.Context, sub structures.EventSubSubscription) error {
+	_, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameEventSubs).UpdateOne(ctx, bson.M{
+		"type":                sub.Type,
+		"broadcaster_user_id": sub.BroadcasterUserID,
+	}, bson.M{
+		"$set": bson.M{
+			"twitch_id":  sub.TwitchID,
+			"status":     sub.Status,
+			"transport":  sub.Transport,
+			"updated_at": time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+
+	return err
+}
+
+// handleRevocation records a revoked subscription and subscribes again when the reason allows it.
+func handleRevocation(gCtx global.Context, sub WebhookSubscription, transport twitch.EventSubTransport) {
+	l := logrus.WithFields(logrus.Fields{
+		"type":        sub.Type,
+		"broadcaster": sub.Condition.BroadcasterUserID,
+		"reason":      sub.Status,
+	})
+	l.Warn("eventsub subscription revoked")
+
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
+	defer cancel()
+
+	now := time.Now()
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameEventSubs).UpdateOne(ctx, bson.M{
+		"type":                sub.Type,
+		"broadcaster_user_id": sub.Condition.BroadcasterUserID,
+	}, bson.M{
+		"$set": bson.M{
+			"twitch_id":      sub.ID,
+			"status":         sub.Status,
+			"transport":      sub.Transport.Method,
+			"revoked_reason": sub.Status,
+			"revoked_at":     now,
+			"updated_at":     now,
+		},
+		"$inc": bson.M{
+			"revocations": 1,
+		},
+	}, options.Update().SetUpsert(true)); err != nil {
+		l.Error("failed to record revocation: ", err)
+	}
+
+	if eventSubRecreate[sub.Status] {
+		if _, err := createEventSub(gCtx, ctx, transport, sub.Type, sub.Condition.BroadcasterUserID); err != nil {
+			l.Error("failed to recreate subscription: ", err)
+		} else {
+			l.Info("recreated subscription")
+		}
+	}
+
+	reportEventSubs(gCtx, ctx)
+}
+
+// reportEventSubs sets the subscription gauges from the recorded state.
+func reportEventSubs(gCtx global.Context, ctx context.Context) {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameEventSubs).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"type":   "$type",
+				"status": "$status",
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		logrus.Error("failed to count eventsub subscriptions: ", err)
+		return
+	}
+
+	counts := []struct {
+		ID struct {
+			Type   string `bson:"type"`
+			Status string `bson:"status"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}{}
+	if err := cur.All(ctx, &counts); err != nil {
+		logrus.Error("failed to count eventsub subscriptions: ", err)
+		return
+	}
+
+	gauge := gCtx.Inst().Prometheus.TwitchEventSubSubscriptions()
+	gauge.Reset()
+	for _, v := range counts {
+		gauge.WithLabelValues(v.ID.Type, v.ID.Status).Set(float64(v.Count))
+	}
+}
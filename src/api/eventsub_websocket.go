@@ -0,0 +1,369 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
+	"github.com/gorilla/websocket"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const eventSubWebsocketURL = "wss://eventsub.wss.twitch.tv/ws"
+
+type EventSubSocketMessage struct {
+	Metadata struct {
+		MessageID        string    `json:"message_id"`
+		MessageType      string    `json:"message_type"`
+		MessageTimestamp time.Time `json:"message_timestamp"`
+	} `json:"metadata"`
+	Payload jsoniter.RawMessage `json:"payload"`
+}
+
+type EventSubSocketSession struct {
+	Session struct {
+		ID                      string `json:"id"`
+		Status                  string `json:"status"`
+		KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+		ReconnectURL            string `json:"reconnect_url"`
+	} `json:"session"`
+}
+
+type eventSubSocketRead struct {
+	conn *websocket.Conn
+	msg  EventSubSocketMessage
+	err  error
+}
+
+// eventSubSocket is a single eventsub websocket session, it survives reconnect messages but not disconnects.
+type eventSubSocket struct {
+	gCtx global.Context
+
+	reads chan eventSubSocketRead
+	done  chan struct{}
+
+	conn    *websocket.Conn
+	pending *websocket.Conn
+
+	sessionID string
+	keepalive time.Duration
+
+	mtx sync.Mutex
+	// subscribed holds the twitch ids of the subscriptions of the session by type and broadcaster
+	subscribed map[string]string
+}
+
+// EventSubWebsocket receives eventsub notifications over a websocket instead of the webhook,
+// it is used when there is no public callback url.
+func EventSubWebsocket(gCtx global.Context) <-chan struct{} {
+	done := make(chan struct{})
+
+	u := gCtx.Config().Twitch.EventSub.WebsocketURL
+	if u == "" {
+		u = eventSubWebsocketURL
+	}
+
+	go func() {
+		defer close(done)
+
+		backoff := time.Second
+		for {
+			start := time.Now()
+			err := runEventSubSocket(gCtx, u)
+			if gCtx.Err() != nil {
+				return
+			}
+
+			logrus.Error("eventsub websocket disconnected: ", err)
+
+			// a session that lived for a while was healthy, so we start backing off from scratch
+			if time.Since(start) > time.Minute {
+				backoff = time.Second
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-gCtx.Done():
+				return
+			}
+
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+		}
+	}()
+
+	return done
+}
+
+func runEventSubSocket(gCtx global.Context, u string) error {
+	s := &eventSubSocket{
+		gCtx:       gCtx,
+		reads:      make(chan eventSubSocketRead, 10),
+		done:       make(chan struct{}),
+		keepalive:  time.Second * 10,
+		subscribed: map[string]string{},
+	}
+	defer s.close()
+
+	conn, err := s.dial(u)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+
+	// new users are picked up the same way the webhook sync loop does it
+	resync := time.NewTicker(time.Minute * 30)
+	defer resync.Stop()
+
+	timeout := time.NewTimer(s.keepalive + time.Second*10)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-gCtx.Done():
+			return nil
+		case <-timeout.C:
+			return fmt.Errorf("no message within keepalive timeout")
+		case <-resync.C:
+			if s.sessionID != "" {
+				go s.subscribe(s.sessionID)
+			}
+		case r := <-s.reads:
+			if r.err != nil {
+				// the old connection is closed by twitch after a reconnect
+				if r.conn != s.conn {
+					continue
+				}
+
+				return r.err
+			}
+
+			if !timeout.Stop() {
+				select {
+				case <-timeout.C:
+				default:
+				}
+			}
+
+			if err := s.handle(r.conn, r.msg); err != nil {
+				return err
+			}
+
+			timeout.Reset(s.keepalive + time.Second*10)
+		}
+	}
+}
+
+func (s *eventSubSocket) dial(u string) (*websocket.Conn, error) {
+	ctx, cancel := context.WithTimeout(s.gCtx, time.Second*10)
+	defer cancel()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.read(conn)
+
+	return conn, nil
+}
+
+func (s *eventSubSocket) read(conn *websocket.Conn) {
+	for {
+		msg := EventSubSocketMessage{}
+		_, data, err := conn.ReadMessage()
+		if err == nil {
+			err = json.Unmarshal(data, &msg)
+		}
+
+		select {
+		case s.reads <- eventSubSocketRead{conn: conn, msg: msg, err: err}:
+		case <-s.done:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *eventSubSocket) close() {
+	close(s.done)
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	if s.pending != nil {
+		_ = s.pending.Close()
+	}
+
+	// subscriptions are bound to the session so they are gone with it
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if _, err := s.gCtx.Inst().Mongo.Collection(mongo.CollectionNameEventSubs).UpdateMany(ctx, bson.M{
+		"transport": "websocket",
+	}, bson.M{
+		"$set": bson.M{
+			"status":     "websocket_disconnected",
+			"updated_at": time.Now(),
+		},
+	}); err != nil {
+		logrus.Error("failed to record websocket disconnect: ", err)
+	}
+	reportEventSubs(s.gCtx, ctx)
+}
+
+func (s *eventSubSocket) handle(conn *websocket.Conn, msg EventSubSocketMessage) error {
+	switch msg.Metadata.MessageType {
+	case "session_welcome":
+		session := EventSubSocketSession{}
+		if err := json.Unmarshal(msg.Payload, &session); err != nil {
+			return err
+		}
+
+		if session.Session.KeepaliveTimeoutSeconds > 0 {
+			s.keepalive = time.Second * time.Duration(session.Session.KeepaliveTimeoutSeconds)
+		}
+
+		if conn == s.pending {
+			// subscriptions carry over to the new connection so there is nothing to create
+			_ = s.conn.Close()
+			s.conn = s.pending
+			s.pending = nil
+			logrus.Info("eventsub websocket reconnected")
+			return nil
+		}
+
+		s.sessionID = session.Session.ID
+		logrus.WithField("session", s.sessionID).Info("eventsub websocket connected")
+		// twitch closes the session when nothing subscribes within a few seconds of the welcome
+		go s.subscribe(s.sessionID)
+	case "session_keepalive":
+	case "session_reconnect":
+		session := EventSubSocketSession{}
+		if err := json.Unmarshal(msg.Payload, &session); err != nil {
+			return err
+		}
+
+		if s.pending != nil {
+			_ = s.pending.Close()
+		}
+
+		// the old connection keeps delivering events until the new one is welcomed
+		pending, err := s.dial(session.Session.ReconnectURL)
+		if err != nil {
+			return err
+		}
+		s.pending = pending
+	case "notification":
+		body := WebhookNotification{}
+		if err := json.Unmarshal(msg.Payload, &body); err != nil {
+			logrus.Errorf("bad body from twitch: %s : %s", err.Error(), msg.Payload)
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(s.gCtx, time.Second*10)
+		defer cancel()
+
+		set, err := markEventSubMessage(s.gCtx, ctx, msg.Metadata.MessageID)
+		if err != nil {
+			logrus.Error("redis failed to set webhook event: ", err)
+		} else if set {
+			handleNotification(s.gCtx, ctx, body)
+		}
+	case "revocation":
+		body := WebhookNotification{}
+		if err := json.Unmarshal(msg.Payload, &body); err != nil {
+			logrus.Errorf("bad body from twitch: %s : %s", err.Error(), msg.Payload)
+			return nil
+		}
+
+		transport := s.transport(s.sessionID)
+		go func() {
+			// subscribe holds the lock while it talks to twitch, so this cant block the read loop
+			s.mtx.Lock()
+			delete(s.subscribed, body.Subscription.Type+":"+body.Subscription.Condition.BroadcasterUserID)
+			s.mtx.Unlock()
+
+			handleRevocation(s.gCtx, body.Subscription, transport)
+		}()
+	default:
+		logrus.Warn("unknown eventsub websocket message: ", msg.Metadata.MessageType)
+	}
+
+	return nil
+}
+
+func (s *eventSubSocket) transport(sessionID string) twitch.EventSubTransport {
+	return twitch.EventSubTransport{
+		Method:    "websocket",
+		SessionID: sessionID,
+	}
+}
+
+// subscribe creates the subscriptions this session does not have yet and deletes the ones of users that were removed.
+func (s *eventSubSocket) subscribe(sessionID string) {
+	ctx, cancel := context.WithTimeout(s.gCtx, time.Second*10)
+	users, err := eventSubUsers(s.gCtx, ctx)
+	cancel()
+	if err != nil {
+		logrus.Error("failed to get users: ", err)
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	wanted := map[string]bool{}
+	for _, v := range users {
+		for _, t := range eventSubTypes {
+			key := t + ":" + v.Twitch.ID
+			wanted[key] = true
+			if s.subscribed[key] != "" {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(s.gCtx, time.Second*10)
+			id, err := createEventSub(s.gCtx, ctx, s.transport(sessionID), t, v.Twitch.ID)
+			cancel()
+			if err != nil {
+				logrus.Errorf("failed to create websocket subscription %s for %s: %s", t, v.Twitch.ID, err.Error())
+				continue
+			}
+
+			s.subscribed[key] = id
+		}
+	}
+
+	for key, id := range s.subscribed {
+		if wanted[key] {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(s.gCtx, time.Second*10)
+		err := s.gCtx.Inst().Twitch.DeleteEventSub(ctx, id)
+		cancel()
+		if err != nil && !twitch.IsStatus(err, http.StatusNotFound) {
+			logrus.Errorf("failed to delete websocket subscription %s: %s", key, err.Error())
+			continue
+		}
+
+		delete(s.subscribed, key)
+	}
+
+	ctx, cancel = context.WithTimeout(s.gCtx, time.Second*10)
+	if err := deleteEventSubRecords(s.gCtx, ctx, users); err != nil {
+		logrus.Error("failed to remove old websocket subscription records: ", err)
+	}
+	reportEventSubs(s.gCtx, ctx)
+	cancel()
+}
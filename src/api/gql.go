@@ -3,21 +3,27 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
 	"github.com/AdmiralBulldogTv/VodApi/graph/generated"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/auth"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/cache"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/complexity"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/loaders"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/middleware"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/resolvers"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/signing"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/types"
 	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/redis"
+	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
 	"github.com/AdmiralBulldogTv/VodApi/src/utils"
 	"github.com/dyninc/qstring"
 	"github.com/sirupsen/logrus"
@@ -61,7 +67,7 @@ func GqlHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
 		req := gqlRequest{}
 		ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
 		ctx.Response.Header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Content-Type")
+		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		ctx.Response.Header.Set("Access-Control-Max-Age", "86400")
 
 		switch utils.B2S(ctx.Method()) {
@@ -89,8 +95,27 @@ func GqlHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
 			return
 		}
 
+		lCtx := context.WithValue(ctx, loaders.LoadersKey, loader)
+		lCtx = context.WithValue(lCtx, helpers.ClientIPKey, signing.ClientIP(gCtx, ctx))
+		header := ctx.Request.Header.Peek("Authorization")
+		admin := false
+		if tkn := gCtx.Config().API.AdminToken; tkn != "" {
+			admin = subtle.ConstantTimeCompare(header, utils.S2B("Bearer "+tkn)) == 1
+			lCtx = context.WithValue(lCtx, helpers.AdminKey, admin)
+		}
+
+		// any other bearer token is a twitch token of a user
+		if tkn := utils.B2S(header); !admin && strings.HasPrefix(tkn, "Bearer ") {
+			user, err := auth.Authenticate(gCtx, ctx, strings.TrimPrefix(tkn, "Bearer "))
+			if err == nil {
+				lCtx = context.WithValue(lCtx, helpers.UserKey, user)
+			} else if !twitch.IsStatus(err, fasthttp.StatusUnauthorized) && err != helpers.ErrUnauthorized && err != mongo.ErrNoDocuments {
+				logrus.Error("failed to authenticate user: ", err)
+			}
+		}
+
 		// Execute the query
-		result := schema.Process(context.WithValue(ctx, loaders.LoadersKey, loader), graphql.RawParams{
+		result := schema.Process(lCtx, graphql.RawParams{
 			Query:         req.Query,
 			OperationName: req.OperationName,
 			Variables:     req.Variables,
@@ -15,4 +15,8 @@ var (
 	ErrInternalServerError ErrorGQL = fmt.Errorf("internal server error")
 	ErrBadInt              ErrorGQL = fmt.Errorf("bad int")
 	ErrDontBeSilly         ErrorGQL = fmt.Errorf("don't be silly")
+	ErrUnknownVariant      ErrorGQL = fmt.Errorf("unknown variant")
+	ErrUnknownProvider     ErrorGQL = fmt.Errorf("unknown emote provider")
+	ErrUnknownVod          ErrorGQL = fmt.Errorf("unknown vod")
+	ErrBadVodState         ErrorGQL = fmt.Errorf("not possible in the current vod state")
 )
@@ -3,5 +3,8 @@ package helpers
 import "github.com/AdmiralBulldogTv/VodApi/src/utils"
 
 const (
-	UserKey = utils.Key("user")
+	UserKey  = utils.Key("user")
+	AdminKey = utils.Key("admin")
+	// ClientIPKey holds the ip media urls are signed for
+	ClientIPKey = utils.Key("client-ip")
 )
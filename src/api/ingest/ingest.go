@@ -0,0 +1,197 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/transcode"
+	"github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+var dropClient = &http.Client{Timeout: time.Second * 10}
+
+// Session is a publish running on the ingest server.
+type Session struct {
+	ClientID string `json:"client_id"`
+	App      string `json:"app"`
+	// KeyHash is the hash of the stream key the publish started with
+	KeyHash string `json:"key_hash"`
+	// VodID is the vod the publish records to
+	VodID primitive.ObjectID `json:"vod_id"`
+}
+
+func sessionKey(userID primitive.ObjectID) string {
+	return "streamer-ingest:" + userID.Hex()
+}
+
+func SetSession(gCtx global.Context, ctx context.Context, userID primitive.ObjectID, session Session) error {
+	data, err := json.MarshalToString(session)
+	if err != nil {
+		return err
+	}
+
+	return gCtx.Inst().Redis.SetEX(ctx, sessionKey(userID), data, time.Hour*48)
+}
+
+// GetSession returns the running publish of a user, redis.Nil is returned when there is none.
+func GetSession(gCtx global.Context, ctx context.Context, userID primitive.ObjectID) (Session, error) {
+	session := Session{}
+
+	data, err := gCtx.Inst().Redis.Get(ctx, sessionKey(userID))
+	if err != nil {
+		return session, err
+	}
+
+	err = json.UnmarshalFromString(data.(string), &session)
+
+	return session, err
+}
+
+// EndLiveVods queues every live vod of the user for transcoding and clears the live keys.
+func EndLiveVods(gCtx global.Context, ctx context.Context, userID primitive.ObjectID) error {
+	if err := endVods(gCtx, ctx, bson.M{
+		"user_id":   userID,
+		"vod_state": structures.VodStateLive,
+	}); err != nil {
+		return err
+	}
+
+	return gCtx.Inst().Redis.Del(ctx, "streamer-live:"+userID.Hex(), sessionKey(userID))
+}
+
+// EndLiveVod queues a live vod of the user for transcoding, the live keys are only cleared while they still point to it.
+func EndLiveVod(gCtx global.Context, ctx context.Context, userID primitive.ObjectID, vodID primitive.ObjectID) error {
+	if err := endVods(gCtx, ctx, bson.M{
+		"_id":       vodID,
+		"user_id":   userID,
+		"vod_state": structures.VodStateLive,
+	}); err != nil {
+		return err
+	}
+
+	keys := []string{}
+	live, err := gCtx.Inst().Redis.Get(ctx, "streamer-live:"+userID.Hex())
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if live == vodID.Hex() {
+		keys = append(keys, "streamer-live:"+userID.Hex())
+	}
+
+	session, err := GetSession(gCtx, ctx, userID)
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err == nil && session.VodID == vodID {
+		keys = append(keys, sessionKey(userID))
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return gCtx.Inst().Redis.Del(ctx, keys...)
+}
+
+func endVods(gCtx global.Context, ctx context.Context, filter bson.M) error {
+	// stream.offline may have ended them already
+	update := bson.M{"ended_at": time.Time{}}
+	for k, v := range filter {
+		update[k] = v
+	}
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).UpdateMany(ctx, update, bson.M{
+		"$set": bson.M{
+			"ended_at": time.Now(),
+		},
+	}); err != nil {
+		return err
+	}
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).Find(ctx, filter)
+	vods := []structures.Vod{}
+	if err == nil {
+		err = cur.All(ctx, &vods)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, vod := range vods {
+		if err := transcode.Dispatch(gCtx, ctx, vod); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Invalidate kicks the publish of a user off the ingest server and ends its vods,
+// unless the publish started with the key hash, which is the hash of the only valid key.
+func Invalidate(gCtx global.Context, ctx context.Context, userID primitive.ObjectID, keyHash string) error {
+	session, err := GetSession(gCtx, ctx, userID)
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+
+		return err
+	}
+
+	if keyHash != "" && session.KeyHash == keyHash {
+		return nil
+	}
+
+	if err := drop(gCtx, ctx, session); err != nil {
+		// the vod still ends here and a new publish with the old key is refused
+		logrus.WithField("user_id", userID.Hex()).Error("failed to drop publisher: ", err)
+	}
+
+	return EndLiveVods(gCtx, ctx, userID)
+}
+
+func drop(gCtx global.Context, ctx context.Context, session Session) error {
+	cfg := gCtx.Config().API.RTMPDrop
+	if cfg.URL == "" {
+		return nil
+	}
+
+	method := cfg.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	u := strings.NewReplacer(
+		"{client_id}", url.QueryEscape(session.ClientID),
+		"{app}", url.QueryEscape(session.App),
+	).Replace(cfg.URL)
+
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := dropClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("bad status resp: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/api/signing"
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/transcode"
+	"github.com/AdmiralBulldogTv/VodApi/src/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VariantPlaylist is the name of the playlist the transcoder writes next to the segments of a variant.
+const VariantPlaylist = "playlist.m3u8"
+
+// mediaPathKey holds the path of a file below the raw vods path.
+const mediaPathKey = "media-path"
+
+var mediaContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+	".aac":  "audio/aac",
+}
+
+// MediaHandler serves a generated master playlist of the ready variants of a vod on /vods/<id>/master.m3u8,
+// and the playlists and segments the transcoder wrote to <raw_vods_path>/<id>/<variant>/ on /vods/<id>/<variant>/<file>.
+// Signed urls put /signed/<token> after the id, which keeps the relative urls of the playlists signed too.
+func MediaHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
+	var files fasthttp.RequestHandler
+	if root := gCtx.Config().API.RawVodsPath; root != "" {
+		files = (&fasthttp.FS{
+			Root:            root,
+			AcceptByteRange: true,
+			PathRewrite: func(ctx *fasthttp.RequestCtx) []byte {
+				return utils.S2B(ctx.UserValue(mediaPathKey).(string))
+			},
+		}).NewRequestHandler()
+	}
+
+	if len(gCtx.Config().API.MediaSigning.Visibilities) != 0 && gCtx.Config().API.MediaSigning.Secret == "" {
+		logrus.Warn("no media signing secret, vods that need signed urls are not served")
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if !ctx.IsGet() && !ctx.IsHead() {
+			ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			return
+		}
+
+		splits := strings.Split(strings.TrimPrefix(utils.B2S(ctx.Path()), "/vods/"), "/")
+		token := ""
+		if len(splits) > 3 && splits[1] == "signed" {
+			token = splits[2]
+			splits = append(splits[:1], splits[3:]...)
+		}
+		if len(splits) != 2 && len(splits) != 3 {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+
+		vID, err := primitive.ObjectIDFromHex(splits[0])
+		if err != nil {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+
+		vod := structures.Vod{}
+		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOne(ctx, bson.M{
+			"_id":            vID,
+			"vod_visibility": structures.VodVisibilityPublic,
+		})
+		err = res.Err()
+		if err == nil {
+			err = res.Decode(&vod)
+		}
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+			} else {
+				logrus.Error("failed to fetch vod: ", err)
+				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			}
+			return
+		}
+
+		if token != "" {
+			if err := signing.Verify(gCtx, vod.ID, token, signing.ClientIP(gCtx, ctx)); err != nil {
+				ctx.SetStatusCode(fasthttp.StatusForbidden)
+				return
+			}
+		} else if signing.Required(gCtx, vod.Visibility.ToModel()) {
+			ctx.SetStatusCode(fasthttp.StatusForbidden)
+			return
+		}
+
+		// signed urls must not be shared by caches, they may be bound to the ip
+		cacheControl := "public"
+		if token != "" {
+			cacheControl = "private"
+		}
+
+		variants := readyVariants(vod)
+
+		if len(splits) == 2 {
+			if splits[1] != "master.m3u8" || len(variants) == 0 {
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+				return
+			}
+
+			ctx.SetContentType(mediaContentTypes[".m3u8"])
+			// variants that become ready later are added to it
+			ctx.Response.Header.Set("Cache-Control", cacheControl+", max-age=60")
+			ctx.SetBodyString(masterPlaylist(variants))
+			return
+		}
+
+		name := splits[2]
+		if files == nil || name == "" || strings.HasPrefix(name, ".") {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+
+		ready := false
+		for _, v := range variants {
+			ready = ready || v.Name == splits[1]
+		}
+		if !ready {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+
+		ctx.SetUserValue(mediaPathKey, "/"+vod.ID.Hex()+"/"+splits[1]+"/"+name)
+		files(ctx)
+
+		status := ctx.Response.StatusCode()
+		if status != fasthttp.StatusOK && status != fasthttp.StatusPartialContent && status != fasthttp.StatusNotModified {
+			return
+		}
+
+		if contentType, ok := mediaContentTypes[path.Ext(name)]; ok {
+			ctx.SetContentType(contentType)
+		}
+
+		if name == VariantPlaylist {
+			ctx.Response.Header.Set("Cache-Control", cacheControl+", max-age=3600")
+		} else {
+			// segments are never rewritten
+			ctx.Response.Header.Set("Cache-Control", cacheControl+", max-age=31536000, immutable")
+		}
+	}
+}
+
+// readyVariants returns the ready variants of a vod with the source resolution filled in, highest bandwidth first.
+func readyVariants(vod structures.Vod) []structures.VodVariant {
+	variants := []structures.VodVariant{}
+	highest := 0
+	for _, v := range vod.Variants {
+		if v.Bitrate > highest {
+			highest = v.Bitrate
+		}
+	}
+
+	for _, v := range vod.Variants {
+		if !v.Ready {
+			continue
+		}
+
+		if v.Name == transcode.SourceVariant {
+			v.Width = vod.Source.Width
+			v.Height = vod.Source.Height
+			v.FPS = vod.Source.FPS
+			v.Bitrate = vod.Source.Bitrate
+			if v.Bitrate == 0 {
+				// older vods have no source bitrate, it is at least the one of the best variant
+				v.Bitrate = highest
+			}
+		}
+
+		variants = append(variants, v)
+	}
+
+	sort.SliceStable(variants, func(i, j int) bool {
+		if variants[i].Name == transcode.SourceVariant {
+			return variants[j].Name != transcode.SourceVariant
+		}
+
+		return variants[j].Name != transcode.SourceVariant && variants[i].Bitrate > variants[j].Bitrate
+	})
+
+	return variants
+}
+
+func masterPlaylist(variants []structures.VodVariant) string {
+	sb := strings.Builder{}
+	sb.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	for _, v := range variants {
+		sb.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d", v.Bitrate))
+		if v.AudioOnly {
+			sb.WriteString(`,CODECS="mp4a.40.2"`)
+		} else {
+			if v.Width != 0 && v.Height != 0 {
+				sb.WriteString(fmt.Sprintf(",RESOLUTION=%dx%d", v.Width, v.Height))
+			}
+			if v.FPS != 0 {
+				sb.WriteString(fmt.Sprintf(",FRAME-RATE=%d.000", v.FPS))
+			}
+		}
+		sb.WriteString(fmt.Sprintf("\n%s/%s\n", v.Name, VariantPlaylist))
+	}
+
+	return sb.String()
+}
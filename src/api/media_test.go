@@ -0,0 +1,100 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+)
+
+func TestReadyVariants(t *testing.T) {
+	source := structures.VodSource{Width: 1920, Height: 1080, FPS: 60, Bitrate: 8000000}
+
+	tests := []struct {
+		name     string
+		source   structures.VodSource
+		variants []structures.VodVariant
+		want     []string
+		bitrate  int
+	}{
+		{
+			name:   "source first then by bitrate",
+			source: source,
+			variants: []structures.VodVariant{
+				{Name: "480p30", Bitrate: 1500000, Ready: true},
+				{Name: "audio", Bitrate: 160000, AudioOnly: true, Ready: true},
+				{Name: "source", Ready: true},
+				{Name: "720p60", Bitrate: 4500000, Ready: true},
+			},
+			want:    []string{"source", "720p60", "480p30", "audio"},
+			bitrate: 8000000,
+		},
+		{
+			name:   "variants that are not ready are left out",
+			source: source,
+			variants: []structures.VodVariant{
+				{Name: "source", Ready: true},
+				{Name: "720p60", Bitrate: 4500000},
+				{Name: "480p30", Bitrate: 1500000, Ready: true, Error: "failed"},
+			},
+			want:    []string{"source", "480p30"},
+			bitrate: 8000000,
+		},
+		{
+			name:   "source without a bitrate takes the highest one",
+			source: structures.VodSource{Width: 1920, Height: 1080, FPS: 60},
+			variants: []structures.VodVariant{
+				{Name: "720p60", Bitrate: 4500000},
+				{Name: "source", Ready: true},
+				{Name: "480p30", Bitrate: 1500000, Ready: true},
+			},
+			want:    []string{"source", "480p30"},
+			bitrate: 4500000,
+		},
+		{
+			name:     "nothing ready",
+			source:   source,
+			variants: []structures.VodVariant{{Name: "source"}},
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readyVariants(structures.Vod{Source: tt.source, Variants: tt.variants})
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %+v", tt.want, got)
+			}
+
+			for i, v := range got {
+				if v.Name != tt.want[i] {
+					t.Fatalf("expected %v, got %+v", tt.want, got)
+				}
+				if v.Name != "source" {
+					continue
+				}
+				if v.Width != tt.source.Width || v.Height != tt.source.Height || v.FPS != tt.source.FPS || v.Bitrate != tt.bitrate {
+					t.Fatalf("expected the source to be filled in, got %+v", v)
+				}
+			}
+		})
+	}
+}
+
+func TestMasterPlaylist(t *testing.T) {
+	got := masterPlaylist([]structures.VodVariant{
+		{Name: "source", Width: 1920, Height: 1080, FPS: 60, Bitrate: 8000000},
+		{Name: "720p30", Width: 1280, Height: 720, Bitrate: 3000000},
+		{Name: "unknown", Bitrate: 1000000},
+		{Name: "audio", Width: 1280, Height: 720, Bitrate: 160000, AudioOnly: true},
+	})
+
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=8000000,RESOLUTION=1920x1080,FRAME-RATE=60.000\nsource/playlist.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720\n720p30/playlist.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000000\nunknown/playlist.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=160000,CODECS=\"mp4a.40.2\"\naudio/playlist.m3u8\n"
+
+	if got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+}
@@ -1,10 +1,30 @@
 package middleware
 
 import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/AdmiralBulldogTv/VodApi/graph/generated"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/auth"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
 	"github.com/AdmiralBulldogTv/VodApi/src/global"
 )
 
 func New(ctx global.Context) generated.DirectiveRoot {
-	return generated.DirectiveRoot{}
+	return generated.DirectiveRoot{
+		Admin: func(ctx context.Context, obj interface{}, next graphql.Resolver) (res interface{}, err error) {
+			if admin, _ := ctx.Value(helpers.AdminKey).(bool); !admin {
+				return nil, helpers.ErrAccessDenied
+			}
+
+			return next(ctx)
+		},
+		Auth: func(ctx context.Context, obj interface{}, next graphql.Resolver) (res interface{}, err error) {
+			if admin, _ := ctx.Value(helpers.AdminKey).(bool); !admin && auth.For(ctx) == nil {
+				return nil, helpers.ErrUnauthorized
+			}
+
+			return next(ctx)
+		},
+	}
 }
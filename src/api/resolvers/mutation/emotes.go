@@ -0,0 +1,62 @@
+package mutation
+
+import (
+	"context"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
+	"github.com/AdmiralBulldogTv/VodApi/src/emotes"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (r *Resolver) UpdateEmoteProviders(ctx context.Context, userID primitive.ObjectID, providers []*model.UserEmoteProviderInput) (*model.User, error) {
+	if _, err := owner(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	settings := []structures.UserEmoteProvider{}
+	seen := map[emotes.EmoteProviderName]bool{}
+	for _, v := range providers {
+		name, ok := emotes.ParseProviderName(v.Name)
+		if !ok {
+			return nil, helpers.ErrUnknownProvider
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			settings = append(settings, structures.UserEmoteProvider{
+				Name:    string(name),
+				Enabled: v.Enabled,
+			})
+		}
+	}
+
+	// the chat ingester picks up the change from the change stream on users
+	user := structures.User{}
+	res := r.Ctx.Inst().Mongo.Collection(mongo.CollectionNameUsers).FindOneAndUpdate(ctx, bson.M{
+		"_id": userID,
+	}, bson.M{
+		"$set": bson.M{
+			"settings.emotes.providers": settings,
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&user)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, helpers.ErrUnknownUser
+		}
+
+		logrus.WithField("user_id", userID.Hex()).Error("failed to update emote providers: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	return user.ToModel(), nil
+}
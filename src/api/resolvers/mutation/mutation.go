@@ -0,0 +1,162 @@
+package mutation
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/generated"
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/auth"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/ingest"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/types"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/utils"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Resolver struct {
+	types.Resolver
+}
+
+func New(r types.Resolver) generated.MutationResolver {
+	return &Resolver{
+		Resolver: r,
+	}
+}
+
+// owner returns the authenticated user when it is the user the stream key belongs to.
+func owner(ctx context.Context, userID primitive.ObjectID) (*structures.User, error) {
+	user := auth.For(ctx)
+	if user == nil || user.ID != userID {
+		return nil, helpers.ErrAccessDenied
+	}
+
+	return user, nil
+}
+
+// ownerOrAdmin is owner that also lets the admin token through.
+func ownerOrAdmin(ctx context.Context, userID primitive.ObjectID) error {
+	if !auth.OwnerOrAdmin(ctx, userID) {
+		return helpers.ErrAccessDenied
+	}
+
+	return nil
+}
+
+// actor returns who makes a change for the vod events.
+func actor(ctx context.Context) structures.VodEventActor {
+	if admin, _ := ctx.Value(helpers.AdminKey).(bool); admin {
+		return structures.VodEventActor{
+			Type: structures.VodEventActorAdmin,
+		}
+	}
+
+	a := structures.VodEventActor{
+		Type: structures.VodEventActorUser,
+	}
+	if user := auth.For(ctx); user != nil {
+		a.UserID = user.ID
+	}
+
+	return a
+}
+
+func (r *Resolver) RevealStreamKey(ctx context.Context, userID primitive.ObjectID) (*model.StreamKey, error) {
+	user, err := owner(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the hash is stored, so all we can show is the prefix
+	return user.StreamKey.ToModel(), nil
+}
+
+func (r *Resolver) RotateStreamKey(ctx context.Context, userID primitive.ObjectID) (*model.StreamKey, error) {
+	if _, err := owner(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	key, err := utils.GenerateRandomString(32)
+	if err != nil {
+		logrus.Error("failed to generate stream key: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	streamKey := structures.UserStreamKey{
+		Hash:      structures.HashStreamKey(key),
+		Prefix:    key[:8],
+		CreatedAt: time.Now(),
+	}
+	if err := r.updateStreamKey(ctx, userID, streamKey, structures.StreamKeyActionRotate); err != nil {
+		return nil, err
+	}
+
+	m := streamKey.ToModel()
+	m.Key = &key
+
+	return m, nil
+}
+
+func (r *Resolver) RevokeStreamKey(ctx context.Context, userID primitive.ObjectID) (*model.StreamKey, error) {
+	user, err := owner(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the prefix is kept so the user can tell which key was revoked
+	streamKey := user.StreamKey
+	streamKey.Hash = ""
+	streamKey.RevokedAt = time.Now()
+	if err := r.updateStreamKey(ctx, userID, streamKey, structures.StreamKeyActionRevoke); err != nil {
+		return nil, err
+	}
+
+	return streamKey.ToModel(), nil
+}
+
+// updateStreamKey replaces the stream key of the user, records it in the audit log
+// and drops any publish that did not start with the new key.
+func (r *Resolver) updateStreamKey(ctx context.Context, userID primitive.ObjectID, streamKey structures.UserStreamKey, action structures.StreamKeyAction) error {
+	l := logrus.WithField("user_id", userID.Hex())
+
+	res, err := r.Ctx.Inst().Mongo.Collection(mongo.CollectionNameUsers).UpdateOne(ctx, bson.M{
+		"_id": userID,
+	}, bson.M{
+		"$set": bson.M{
+			"hashed_stream_key": streamKey,
+		},
+		// a key that was not migrated yet is revoked along with it
+		"$unset": bson.M{
+			"stream_key": "",
+		},
+	})
+	if err == nil && res.MatchedCount == 0 {
+		return helpers.ErrUnknownUser
+	}
+	if err != nil {
+		l.Error("failed to update stream key: ", err)
+		return helpers.ErrInternalServerError
+	}
+
+	if _, err := r.Ctx.Inst().Mongo.Collection(mongo.CollectionNameStreamKeyAudit).InsertOne(ctx, structures.StreamKeyAudit{
+		UserID:    userID,
+		Action:    action,
+		Prefix:    streamKey.Prefix,
+		Timestamp: time.Now(),
+	}); err != nil {
+		l.Error("failed to store stream key audit: ", err)
+	}
+
+	if err := ingest.Invalidate(r.Ctx, ctx, userID, streamKey.Hash); err != nil {
+		l.Error("failed to invalidate ingest session: ", err)
+		return helpers.ErrInternalServerError
+	}
+
+	l.WithField("action", action).Info("stream key updated")
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package mutation
+
+import (
+	"context"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/transcode"
+	"github.com/AdmiralBulldogTv/VodApi/src/vods"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (r *Resolver) UpdateTranscodeLadder(ctx context.Context, userID primitive.ObjectID, ladder []string) (*model.User, error) {
+	if _, err := owner(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, v := range transcode.Variants(r.Ctx) {
+		known[v.Name] = true
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, name := range ladder {
+		if !known[name] {
+			return nil, helpers.ErrUnknownVariant
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	user := structures.User{}
+	res := r.Ctx.Inst().Mongo.Collection(mongo.CollectionNameUsers).FindOneAndUpdate(ctx, bson.M{
+		"_id": userID,
+	}, bson.M{
+		"$set": bson.M{
+			"settings.transcode.ladder": names,
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&user)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, helpers.ErrUnknownUser
+		}
+
+		logrus.WithField("user_id", userID.Hex()).Error("failed to update transcode ladder: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	return user.ToModel(), nil
+}
+
+func (r *Resolver) RequeueVodTranscodes(ctx context.Context, id primitive.ObjectID) (*model.Vod, error) {
+	return r.updateTranscodes(ctx, id, transcode.Requeue)
+}
+
+func (r *Resolver) CancelVodTranscodes(ctx context.Context, id primitive.ObjectID) (*model.Vod, error) {
+	return r.updateTranscodes(ctx, id, transcode.Cancel)
+}
+
+func (r *Resolver) updateTranscodes(ctx context.Context, id primitive.ObjectID, fn func(gCtx global.Context, ctx context.Context, vod structures.Vod, actor structures.VodEventActor) (structures.Vod, error)) (*model.Vod, error) {
+	vod, err := vods.Get(r.Ctx, ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, helpers.ErrUnknownVod
+		}
+
+		logrus.Error("failed to fetch vod: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	if err := ownerOrAdmin(ctx, vod.UserID); err != nil {
+		return nil, err
+	}
+
+	vod, err = fn(r.Ctx, ctx, vod, actor(ctx))
+	if err != nil {
+		if err == vods.ErrBadTransition {
+			return nil, helpers.ErrBadVodState
+		}
+
+		logrus.WithField("vod_id", id.Hex()).Error("failed to update transcodes: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	return vod.ToModel(), nil
+}
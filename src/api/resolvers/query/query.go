@@ -11,6 +11,7 @@ import (
 	"github.com/AdmiralBulldogTv/VodApi/src/api/types"
 	"github.com/AdmiralBulldogTv/VodApi/src/structures"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/transcode"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -53,7 +54,7 @@ func (r *Resolver) User(ctx context.Context, uID primitive.ObjectID) (*model.Use
 	return user, nil
 }
 
-func (r *Resolver) Messages(ctx context.Context, vID primitive.ObjectID, limit int, page int, after time.Time, before time.Time) ([]*model.Chat, error) {
+func (r *Resolver) Messages(ctx context.Context, vID primitive.ObjectID, limit int, page int, after time.Time, before time.Time, hideDeleted *bool) ([]model.ChatEvent, error) {
 	filter := bson.M{
 		"vod_id": vID,
 		"timestamp": bson.M{
@@ -62,6 +63,12 @@ func (r *Resolver) Messages(ctx context.Context, vID primitive.ObjectID, limit i
 		},
 	}
 
+	if hideDeleted != nil && *hideDeleted {
+		filter["deleted"] = bson.M{
+			"$exists": false,
+		}
+	}
+
 	if limit <= 0 {
 		limit = 500
 	} else if limit > 2500 {
@@ -83,9 +90,9 @@ func (r *Resolver) Messages(ctx context.Context, vID primitive.ObjectID, limit i
 		return nil, helpers.ErrInternalServerError
 	}
 
-	chats := make([]*model.Chat, len(dbChat))
+	chats := make([]model.ChatEvent, len(dbChat))
 	for i, chat := range dbChat {
-		chats[i] = chat.ToModel()
+		chats[i] = chat.ToEvent()
 	}
 
 	return chats, nil
@@ -143,3 +150,153 @@ func (r *Resolver) Vods(ctx context.Context, userID primitive.ObjectID, limit in
 
 	return vods, nil
 }
+
+func (r *Resolver) EventsubSubscriptions(ctx context.Context, status *string) ([]*model.EventSubSubscription, error) {
+	filter := bson.M{}
+	if status != nil {
+		filter["status"] = *status
+	}
+
+	cur, err := r.Ctx.Inst().Mongo.Collection(mongo.CollectionNameEventSubs).Find(ctx, filter, options.Find().SetSort(bson.D{
+		{Key: "broadcaster_user_id", Value: 1},
+		{Key: "type", Value: 1},
+	}))
+	dbSubs := []structures.EventSubSubscription{}
+	if err == nil {
+		err = cur.All(ctx, &dbSubs)
+	}
+	if err != nil {
+		logrus.Error("failed to fetch eventsub subscriptions: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	subs := make([]*model.EventSubSubscription, len(dbSubs))
+	for i, sub := range dbSubs {
+		subs[i] = sub.ToModel()
+	}
+
+	return subs, nil
+}
+
+func (r *Resolver) Categories(ctx context.Context, userID primitive.ObjectID) ([]*model.UserCategory, error) {
+	cur, err := r.Ctx.Inst().Mongo.Collection(mongo.CollectionNameVods).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id":        userID,
+			"vod_visibility": structures.VodVisibilityPublic,
+		}}},
+		{{Key: "$sort", Value: bson.M{
+			"started_at": 1,
+		}}},
+		// live vods have no end yet, they run until now
+		{{Key: "$addFields", Value: bson.M{
+			"categories": bson.M{"$ifNull": bson.A{"$categories", bson.A{}}},
+			"ended_at": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$ended_at", "$started_at"}},
+				"$ended_at",
+				time.Now(),
+			}},
+		}}},
+		// the same chapters as Vod.Chapters, a category runs until the next one or the end of the vod
+		{{Key: "$project", Value: bson.M{
+			"chapters": bson.M{"$map": bson.M{
+				"input": bson.M{"$range": bson.A{0, bson.M{"$size": "$categories"}}},
+				"as":    "i",
+				"in": bson.M{
+					"id":   bson.M{"$arrayElemAt": bson.A{"$categories.id", "$$i"}},
+					"name": bson.M{"$arrayElemAt": bson.A{"$categories.name", "$$i"}},
+					"start": bson.M{"$max": bson.A{
+						bson.M{"$arrayElemAt": bson.A{"$categories.timestamp", "$$i"}},
+						"$started_at",
+					}},
+					"end": bson.M{"$min": bson.A{
+						bson.M{"$ifNull": bson.A{
+							bson.M{"$arrayElemAt": bson.A{"$categories.timestamp", bson.M{"$add": bson.A{"$$i", 1}}}},
+							"$ended_at",
+						}},
+						"$ended_at",
+					}},
+				},
+			}},
+		}}},
+		{{Key: "$unwind", Value: "$chapters"}},
+		{{Key: "$project", Value: bson.M{
+			"id":       "$chapters.id",
+			"name":     "$chapters.name",
+			"start":    "$chapters.start",
+			"duration": bson.M{"$subtract": bson.A{"$chapters.end", "$chapters.start"}},
+		}}},
+		{{Key: "$match", Value: bson.M{
+			"duration": bson.M{"$gt": 0},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$id",
+			"name":     bson.M{"$first": "$name"},
+			"first":    bson.M{"$min": "$start"},
+			"duration": bson.M{"$sum": "$duration"},
+			"vods":     bson.M{"$addToSet": "$_id"},
+		}}},
+		// most streamed first, ties keep the order they were first streamed in
+		{{Key: "$sort", Value: bson.D{
+			{Key: "duration", Value: -1},
+			{Key: "first", Value: 1},
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         string(mongo.CollectionNameCategories),
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "category",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"name":     1,
+			"duration": 1,
+			"vods":     bson.M{"$size": "$vods"},
+			"category": 1,
+		}}},
+	})
+	dbCategories := []struct {
+		ID   string `bson:"_id"`
+		Name string `bson:"name"`
+		// Duration is in milliseconds
+		Duration int64                 `bson:"duration"`
+		Vods     int                   `bson:"vods"`
+		Category []structures.Category `bson:"category"`
+	}{}
+	if err == nil {
+		err = cur.All(ctx, &dbCategories)
+	}
+	if err != nil {
+		logrus.Error("failed to fetch categories: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	categories := make([]*model.UserCategory, len(dbCategories))
+	for i, c := range dbCategories {
+		// categories helix never resolved keep the name of the event
+		category := structures.Category{
+			ID:        c.ID,
+			Name:      c.Name,
+			BoxArtURL: structures.CategoryUnknownBoxArtURL,
+		}
+		if len(c.Category) != 0 {
+			category = c.Category[0]
+		}
+
+		categories[i] = &model.UserCategory{
+			Category:      category.ToModel(),
+			HoursStreamed: (time.Duration(c.Duration) * time.Millisecond).Hours(),
+			VodCount:      c.Vods,
+		}
+	}
+
+	return categories, nil
+}
+
+func (r *Resolver) TranscodeVariants(ctx context.Context) ([]*model.TranscodeVariant, error) {
+	dbVariants := transcode.Variants(r.Ctx)
+	variants := make([]*model.TranscodeVariant, len(dbVariants))
+	for i, v := range dbVariants {
+		variants[i] = v.ToTranscodeModel()
+	}
+
+	return variants, nil
+}
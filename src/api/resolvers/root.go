@@ -2,6 +2,7 @@ package resolvers
 
 import (
 	"github.com/AdmiralBulldogTv/VodApi/graph/generated"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/resolvers/mutation"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/resolvers/query"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/resolvers/user"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/resolvers/vod"
@@ -10,15 +11,17 @@ import (
 
 type Resolver struct {
 	types.Resolver
-	query generated.QueryResolver
-	vod   generated.VodResolver
-	user  generated.UserResolver
+	query    generated.QueryResolver
+	mutation generated.MutationResolver
+	vod      generated.VodResolver
+	user     generated.UserResolver
 }
 
 func New(r types.Resolver) generated.ResolverRoot {
 	return &Resolver{
 		Resolver: r,
 		query:    query.New(r),
+		mutation: mutation.New(r),
 		vod:      vod.New(r),
 		user:     user.New(r),
 	}
@@ -28,6 +31,10 @@ func (r *Resolver) Query() generated.QueryResolver {
 	return r.query
 }
 
+func (r *Resolver) Mutation() generated.MutationResolver {
+	return r.mutation
+}
+
 func (r *Resolver) Vod() generated.VodResolver {
 	return r.vod
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/AdmiralBulldogTv/VodApi/src/api/types"
 	"github.com/AdmiralBulldogTv/VodApi/src/structures"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/transcode"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -77,3 +78,18 @@ func (r *Resolver) Vods(ctx context.Context, obj *model.User, limit int, page in
 
 	return vods, nil
 }
+
+func (r *Resolver) TranscodeLadder(ctx context.Context, obj *model.User) ([]*model.TranscodeVariant, error) {
+	settings := structures.UserTranscodeSettings{}
+	if obj.Settings != nil && obj.Settings.Transcode != nil {
+		settings.Ladder = obj.Settings.Transcode.Ladder
+	}
+
+	dbLadder := transcode.Ladder(r.Ctx, settings)
+	ladder := make([]*model.TranscodeVariant, len(dbLadder))
+	for i, v := range dbLadder {
+		ladder[i] = v.ToTranscodeModel()
+	}
+
+	return ladder, nil
+}
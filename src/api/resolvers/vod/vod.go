@@ -5,8 +5,16 @@ import (
 
 	"github.com/AdmiralBulldogTv/VodApi/graph/generated"
 	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/auth"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/loaders"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/signing"
 	"github.com/AdmiralBulldogTv/VodApi/src/api/types"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Resolver struct {
@@ -20,3 +28,77 @@ func New(r types.Resolver) generated.VodResolver {
 func (r *Resolver) User(ctx context.Context, obj *model.Vod) (*model.User, error) {
 	return loaders.For(ctx).UserLoader.Load(obj.UserID)
 }
+
+func (r *Resolver) Variants(ctx context.Context, obj *model.Vod) ([]*model.VodVariant, error) {
+	if auth.OwnerOrAdmin(ctx, obj.UserID) {
+		return obj.Variants, nil
+	}
+
+	// transcoder errors can name internal hosts and paths
+	variants := make([]*model.VodVariant, len(obj.Variants))
+	for i, v := range obj.Variants {
+		variant := *v
+		variant.Error = nil
+		variants[i] = &variant
+	}
+
+	return variants, nil
+}
+
+func (r *Resolver) TranscodeErrors(ctx context.Context, obj *model.Vod) ([]*model.VodTranscodeError, error) {
+	if !auth.OwnerOrAdmin(ctx, obj.UserID) {
+		return []*model.VodTranscodeError{}, nil
+	}
+
+	return obj.TranscodeErrors, nil
+}
+
+func (r *Resolver) Events(ctx context.Context, obj *model.Vod) ([]*model.VodEvent, error) {
+	// the reasons carry transcoder errors and the actors are user ids
+	if !auth.OwnerOrAdmin(ctx, obj.UserID) {
+		return []*model.VodEvent{}, nil
+	}
+
+	cur, err := r.Ctx.Inst().Mongo.Collection(mongo.CollectionNameVodEvents).Find(ctx, bson.M{
+		"vod_id": obj.ID,
+	}, options.Find().SetSort(bson.M{
+		"timestamp": 1,
+	}))
+	dbEvents := []structures.VodEvent{}
+	if err == nil {
+		err = cur.All(ctx, &dbEvents)
+	}
+	if err != nil {
+		logrus.Error("failed to fetch vod events: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	events := make([]*model.VodEvent, len(dbEvents))
+	for i, event := range dbEvents {
+		events[i] = event.ToModel()
+	}
+
+	return events, nil
+}
+
+func (r *Resolver) PlaybackURL(ctx context.Context, obj *model.Vod) (*string, error) {
+	if obj.Visibility != model.VodVisibilityPublic {
+		return nil, nil
+	}
+
+	ready := false
+	for _, v := range obj.Variants {
+		ready = ready || v.Ready
+	}
+	if !ready {
+		return nil, nil
+	}
+
+	u, err := signing.PlaybackURL(r.Ctx, obj.ID, obj.Visibility, signing.ClientIPFor(ctx))
+	if err != nil {
+		logrus.Error("failed to sign playback url: ", err)
+		return nil, helpers.ErrInternalServerError
+	}
+
+	return &u, nil
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/api/ingest"
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/utils"
+	"github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RTMPHook is a publish callback from the ingest server.
+// nginx-rtmp posts a form while srs posts json, the stream key is the stream name or a key query param.
+type RTMPHook struct {
+	Key  string
+	Addr string
+	// ClientID and App identify the publish when it has to be dropped
+	ClientID string
+	App      string
+}
+
+type srsHook struct {
+	// older srs versions send a number
+	ClientID jsoniter.RawMessage `json:"client_id"`
+	IP       string              `json:"ip"`
+	App      string              `json:"app"`
+	Stream   string              `json:"stream"`
+	Param    string              `json:"param"`
+}
+
+// RTMPHandler serves /rtmp/on_publish and /rtmp/on_publish_done.
+// A successful response has a 200 status and a 0 body, which both nginx-rtmp and srs accept.
+func RTMPHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !ctx.IsPost() {
+			ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+			return
+		}
+
+		if secret := gCtx.Config().API.RTMPHookSecret; secret != "" {
+			if subtle.ConstantTimeCompare(ctx.QueryArgs().Peek("secret"), utils.S2B(secret)) != 1 {
+				ctx.SetStatusCode(fasthttp.StatusForbidden)
+				return
+			}
+		}
+
+		hook, err := parseRTMPHook(ctx)
+		if err != nil {
+			logrus.Errorf("bad body from rtmp: %s : %s", err.Error(), ctx.Request.Body())
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			return
+		}
+
+		user, err := userByStreamKey(gCtx, ctx, hook.Key)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				logrus.WithField("addr", hook.Addr).Warn("rtmp publish with unknown stream key")
+				ctx.SetStatusCode(fasthttp.StatusForbidden)
+			} else {
+				logrus.Error("failed to fetch user: ", err)
+				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			}
+			return
+		}
+
+		var status int
+		switch strings.TrimPrefix(utils.B2S(ctx.Path()), "/rtmp/") {
+		case "on_publish":
+			status = handlePublish(gCtx, ctx, user, hook)
+		case "on_publish_done":
+			status = handlePublishDone(gCtx, ctx, user, hook)
+		default:
+			status = fasthttp.StatusNotFound
+		}
+
+		ctx.SetStatusCode(status)
+		if status == fasthttp.StatusOK {
+			ctx.SetBodyString("0")
+		}
+	}
+}
+
+func parseRTMPHook(ctx *fasthttp.RequestCtx) (RTMPHook, error) {
+	if bytes.HasPrefix(ctx.Request.Header.ContentType(), utils.S2B("application/json")) {
+		body := srsHook{}
+		if err := json.Unmarshal(ctx.Request.Body(), &body); err != nil {
+			return RTMPHook{}, err
+		}
+
+		hook := RTMPHook{
+			Key:      body.Stream,
+			Addr:     body.IP,
+			ClientID: strings.Trim(string(body.ClientID), `"`),
+			App:      body.App,
+		}
+		if query, err := url.ParseQuery(strings.TrimPrefix(body.Param, "?")); err == nil && query.Get("key") != "" {
+			hook.Key = query.Get("key")
+		}
+
+		return hook, nil
+	}
+
+	args := ctx.PostArgs()
+	hook := RTMPHook{
+		Key:      utils.B2S(args.Peek("name")),
+		Addr:     utils.B2S(args.Peek("addr")),
+		ClientID: utils.B2S(args.Peek("clientid")),
+		App:      utils.B2S(args.Peek("app")),
+	}
+	if key := args.Peek("key"); len(key) != 0 {
+		hook.Key = utils.B2S(key)
+	}
+
+	return hook, nil
+}
+
+func userByStreamKey(gCtx global.Context, ctx context.Context, key string) (structures.User, error) {
+	user := structures.User{}
+	if key == "" {
+		return user, mongo.ErrNoDocuments
+	}
+
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"hashed_stream_key.hash": structures.HashStreamKey(key)},
+			// keys that were not migrated yet are stored as is
+			bson.M{"stream_key": key},
+		},
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&user)
+	}
+
+	return user, err
+}
+
+func handlePublish(gCtx global.Context, ctx context.Context, user structures.User, hook RTMPHook) int {
+	l := logrus.WithField("user_id", user.ID.Hex())
+
+	// a publish that never finished would otherwise keep the user live forever
+	if err := ingest.EndLiveVods(gCtx, ctx, user.ID); err != nil {
+		l.Error("failed to end previous vod: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	now := time.Now()
+	vod := structures.Vod{
+		ID:              primitive.NewObjectID(),
+		UserID:          user.ID,
+		Titles:          []structures.VodTitle{},
+		Categories:      []structures.VodCategory{},
+		Variants:        []structures.VodVariant{},
+		TranscodeErrors: []structures.VodTranscodeError{},
+		State:           structures.VodStateLive,
+		Visibility:      structures.VodVisibilityPublic,
+		StartedAt:       now,
+	}
+
+	// the title and category only change with channel.update, so we start with what the channel has right now
+	info, err := gCtx.Inst().Twitch.GetChannelInformation(ctx, user.Twitch.ID)
+	if err == nil {
+		category := resolveCategory(gCtx, ctx, info.GameID, info.GameName)
+		vod.Title = info.Title
+		vod.Titles = append(vod.Titles, structures.VodTitle{
+			Timestamp: now,
+			Title:     info.Title,
+			Language:  info.BroadcasterLanguage,
+		})
+		vod.Categories = append(vod.Categories, structures.VodCategory{
+			Timestamp: now,
+			Name:      category.Name,
+			ID:        category.ID,
+			URL:       category.BoxArt(144, 192),
+		})
+	} else {
+		l.Error("failed to get channel information: ", err)
+	}
+
+	// twitch may already have told us the stream is online
+	stream := structures.Stream{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionStreams).FindOneAndUpdate(ctx, bson.M{
+		"user_id":  user.ID,
+		"ended_at": time.Time{},
+		"vod_id":   bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{
+			"vod_id": vod.ID,
+		},
+	}, options.FindOneAndUpdate().SetSort(bson.M{"started_at": -1}))
+	err = res.Err()
+	if err == nil {
+		err = res.Decode(&stream)
+	}
+	if err == nil {
+		vod.TwitchStreamID = stream.Twitch.ID
+	} else if err != mongo.ErrNoDocuments {
+		l.Error("failed to link stream: ", err)
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).InsertOne(ctx, vod); err != nil {
+		l.Error("failed to create vod: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	if err := gCtx.Inst().Redis.SetEX(ctx, "streamer-live:"+user.ID.Hex(), vod.ID.Hex(), time.Hour*48); err != nil {
+		l.Error("failed to mark streamer live: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	// revoking the key drops this publish
+	if err := ingest.SetSession(gCtx, ctx, user.ID, ingest.Session{
+		ClientID: hook.ClientID,
+		App:      hook.App,
+		KeyHash:  structures.HashStreamKey(hook.Key),
+		VodID:    vod.ID,
+	}); err != nil {
+		l.Error("failed to store ingest session: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	l.WithField("vod_id", vod.ID.Hex()).Info("rtmp publish started")
+
+	return fasthttp.StatusOK
+}
+
+func handlePublishDone(gCtx global.Context, ctx context.Context, user structures.User, hook RTMPHook) int {
+	l := logrus.WithField("user_id", user.ID.Hex())
+
+	// a late callback of an older publish must not end the vod of the one that replaced it
+	session, err := ingest.GetSession(gCtx, ctx, user.ID)
+	if err != nil {
+		if err == redis.Nil {
+			l.WithField("client_id", hook.ClientID).Info("rtmp publish done without a session")
+			return fasthttp.StatusOK
+		}
+
+		l.Error("failed to fetch ingest session: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	if session.ClientID != hook.ClientID {
+		l.WithField("client_id", hook.ClientID).Info("rtmp publish done of another session")
+		return fasthttp.StatusOK
+	}
+
+	if session.VodID.IsZero() {
+		// sessions stored before they knew their vod
+		err = ingest.EndLiveVods(gCtx, ctx, user.ID)
+	} else {
+		err = ingest.EndLiveVod(gCtx, ctx, user.ID, session.VodID)
+	}
+	if err != nil {
+		l.Error("failed to end vod: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	l.WithField("vod_id", session.VodID.Hex()).Info("rtmp publish done")
+
+	return fasthttp.StatusOK
+}
@@ -0,0 +1,143 @@
+package signing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+	"github.com/AdmiralBulldogTv/VodApi/src/api/helpers"
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/utils"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNoSecret  = errors.New("no signing secret")
+	ErrBadToken  = errors.New("bad token")
+	ErrExpired   = errors.New("token expired")
+	ErrSignature = errors.New("bad signature")
+)
+
+// Required is true when the media of vods with the visibility is only served on signed urls.
+func Required(gCtx global.Context, visibility model.VodVisibility) bool {
+	for _, v := range gCtx.Config().API.MediaSigning.Visibilities {
+		if strings.EqualFold(v, string(visibility)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ttl(gCtx global.Context) time.Duration {
+	if d := gCtx.Config().API.MediaSigning.TTL; d > 0 {
+		return d
+	}
+
+	return time.Hour * 6
+}
+
+// Sign returns a token for the media of a vod that expires after the configured ttl, the ip is ignored unless urls are bound to it.
+func Sign(gCtx global.Context, vodID primitive.ObjectID, ip string) (string, error) {
+	cfg := gCtx.Config().API.MediaSigning
+	if cfg.Secret == "" {
+		return "", ErrNoSecret
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl(gCtx)).Unix(), 10)
+	if !cfg.BindIP {
+		ip = ""
+	}
+
+	return expires + "." + signature(cfg.Secret, vodID, expires, ip), nil
+}
+
+// Verify checks a token for the media of a vod requested from the ip.
+func Verify(gCtx global.Context, vodID primitive.ObjectID, token string, ip string) error {
+	cfg := gCtx.Config().API.MediaSigning
+	if cfg.Secret == "" {
+		return ErrNoSecret
+	}
+
+	splits := strings.SplitN(token, ".", 2)
+	if len(splits) != 2 {
+		return ErrBadToken
+	}
+
+	expires, err := strconv.ParseInt(splits[0], 10, 64)
+	if err != nil {
+		return ErrBadToken
+	}
+
+	if !cfg.BindIP {
+		ip = ""
+	}
+
+	if !hmac.Equal([]byte(splits[1]), []byte(signature(cfg.Secret, vodID, splits[0], ip))) {
+		return ErrSignature
+	}
+
+	if time.Now().Unix() > expires {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func signature(secret string, vodID primitive.ObjectID, expires string, ip string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(vodID.Hex() + "\n" + expires + "\n" + ip))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ClientIP is the ip of the client, the configured header is trusted to hold it when the api runs behind a proxy.
+func ClientIP(gCtx global.Context, ctx *fasthttp.RequestCtx) string {
+	if header := gCtx.Config().API.ClientIPHeader; header != "" {
+		// every proxy appends the ip it got the request from, the entries left of the trusted ones are made up by the client
+		hops := gCtx.Config().API.TrustedProxies
+		if hops <= 0 {
+			hops = 1
+		}
+
+		entries := strings.Split(utils.B2S(ctx.Request.Header.Peek(header)), ",")
+		i := len(entries) - hops
+		if i < 0 {
+			i = 0
+		}
+
+		if ip := strings.TrimSpace(entries[i]); ip != "" {
+			return ip
+		}
+	}
+
+	return ctx.RemoteIP().String()
+}
+
+// ClientIPFor returns the ip of the client of a gql request.
+func ClientIPFor(ctx context.Context) string {
+	ip, _ := ctx.Value(helpers.ClientIPKey).(string)
+	return ip
+}
+
+// PlaybackURL returns the url of the master playlist of a vod, it is signed when the visibility of the vod needs it.
+func PlaybackURL(gCtx global.Context, vodID primitive.ObjectID, visibility model.VodVisibility, ip string) (string, error) {
+	u := strings.TrimSuffix(gCtx.Config().API.PublicURL, "/") + "/vods/" + vodID.Hex()
+	if Required(gCtx, visibility) {
+		token, err := Sign(gCtx, vodID, ip)
+		if err != nil {
+			return "", err
+		}
+
+		u += "/signed/" + token
+	}
+
+	return u + "/master.m3u8", nil
+}
@@ -0,0 +1,146 @@
+package signing
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/configure"
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/valyala/fasthttp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func signingContext(secret string, bindIP bool) global.Context {
+	cfg := &configure.Config{}
+	cfg.API.MediaSigning.Secret = secret
+	cfg.API.MediaSigning.BindIP = bindIP
+
+	return global.New(context.Background(), cfg)
+}
+
+func TestSignVerify(t *testing.T) {
+	vodID := primitive.NewObjectID()
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		bindIP bool
+		token  func(gCtx global.Context) string
+		ip     string
+		err    error
+	}{
+		{
+			name:  "signed token",
+			token: func(gCtx global.Context) string { token, _ := Sign(gCtx, vodID, "1.1.1.1"); return token },
+			ip:    "1.1.1.1",
+		},
+		{
+			name:  "ip is ignored unless bound",
+			token: func(gCtx global.Context) string { token, _ := Sign(gCtx, vodID, "1.1.1.1"); return token },
+			ip:    "2.2.2.2",
+		},
+		{
+			name:   "bound ip",
+			bindIP: true,
+			token:  func(gCtx global.Context) string { token, _ := Sign(gCtx, vodID, "1.1.1.1"); return token },
+			ip:     "1.1.1.1",
+		},
+		{
+			name:   "wrong ip",
+			bindIP: true,
+			token:  func(gCtx global.Context) string { token, _ := Sign(gCtx, vodID, "1.1.1.1"); return token },
+			ip:     "2.2.2.2",
+			err:    ErrSignature,
+		},
+		{
+			name:  "other vod",
+			token: func(gCtx global.Context) string { token, _ := Sign(gCtx, primitive.NewObjectID(), ""); return token },
+			err:   ErrSignature,
+		},
+		{
+			name: "other secret",
+			token: func(gCtx global.Context) string {
+				token, _ := Sign(signingContext("other", false), vodID, "")
+				return token
+			},
+			err: ErrSignature,
+		},
+		{
+			name:  "expired",
+			token: func(gCtx global.Context) string { return expired + "." + signature("secret", vodID, expired, "") },
+			err:   ErrExpired,
+		},
+		{
+			name:  "no signature",
+			token: func(gCtx global.Context) string { return expired },
+			err:   ErrBadToken,
+		},
+		{
+			name:  "bad expiry",
+			token: func(gCtx global.Context) string { return "soon." + signature("secret", vodID, "soon", "") },
+			err:   ErrBadToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gCtx := signingContext("secret", tt.bindIP)
+
+			if err := Verify(gCtx, vodID, tt.token(gCtx), tt.ip); err != tt.err {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSignWithoutSecret(t *testing.T) {
+	gCtx := signingContext("", false)
+
+	if _, err := Sign(gCtx, primitive.NewObjectID(), ""); err != ErrNoSecret {
+		t.Fatalf("expected %v, got %v", ErrNoSecret, err)
+	}
+	if err := Verify(gCtx, primitive.NewObjectID(), "1.abc", ""); err != ErrNoSecret {
+		t.Fatalf("expected %v, got %v", ErrNoSecret, err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		hops   int
+		value  string
+		want   string
+	}{
+		{name: "no header configured", value: "1.1.1.1", want: "9.9.9.9"},
+		{name: "single proxy", header: "X-Forwarded-For", value: "1.1.1.1", want: "1.1.1.1"},
+		{name: "spoofed entries are skipped", header: "X-Forwarded-For", value: "6.6.6.6, 1.1.1.1", want: "1.1.1.1"},
+		{name: "two proxies", header: "X-Forwarded-For", hops: 2, value: "6.6.6.6, 1.1.1.1, 2.2.2.2", want: "1.1.1.1"},
+		{name: "fewer entries than proxies", header: "X-Forwarded-For", hops: 3, value: "1.1.1.1, 2.2.2.2", want: "1.1.1.1"},
+		{name: "missing header", header: "X-Forwarded-For", want: "9.9.9.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &configure.Config{}
+			cfg.API.ClientIPHeader = tt.header
+			cfg.API.TrustedProxies = tt.hops
+			gCtx := global.New(context.Background(), cfg)
+
+			req := &fasthttp.Request{}
+			if tt.value != "" {
+				req.Header.Set("X-Forwarded-For", tt.value)
+			}
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Init(req, &net.TCPAddr{IP: net.ParseIP("9.9.9.9")}, nil)
+
+			if got := ClientIP(gCtx, ctx); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -5,20 +5,22 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/AdmiralBulldogTv/VodApi/src/api/ingest"
 	"github.com/AdmiralBulldogTv/VodApi/src/global"
 	"github.com/AdmiralBulldogTv/VodApi/src/structures"
 	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
 	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
 	"github.com/AdmiralBulldogTv/VodApi/src/utils"
 	"github.com/go-redis/redis/v8"
-	"github.com/nicklaw5/helix"
 	"github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type WebhookSubscription struct {
@@ -44,14 +46,17 @@ type WebhookVerifyPending struct {
 type WebhookNotification struct {
 	Subscription WebhookSubscription `json:"subscription"`
 	Event        struct {
-		BroadcasterUserID    string `json:"broadcaster_user_id"`
-		BroadcasterUserLogin string `json:"broadcaster_user_login"`
-		BroadcasterUserName  string `json:"broadcaster_user_name"`
-		Title                string `json:"title"`
-		Language             string `json:"language"`
-		CategoryID           string `json:"category_id"`
-		CategoryName         string `json:"category_name"`
-		IsMature             bool   `json:"is_mature"`
+		ID                   string    `json:"id"`
+		Type                 string    `json:"type"`
+		StartedAt            time.Time `json:"started_at"`
+		BroadcasterUserID    string    `json:"broadcaster_user_id"`
+		BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+		BroadcasterUserName  string    `json:"broadcaster_user_name"`
+		Title                string    `json:"title"`
+		Language             string    `json:"language"`
+		CategoryID           string    `json:"category_id"`
+		CategoryName         string    `json:"category_name"`
+		IsMature             bool      `json:"is_mature"`
 	} `json:"event"`
 }
 
@@ -70,68 +75,81 @@ func WebhookTwitchHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
 			}
 
 			ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
-			subs, err := twitch.GetEventSubs(gCtx, ctx)
+			subs, err := gCtx.Inst().Twitch.GetEventSubs(ctx)
 			cancel()
 			if err != nil {
 				logrus.Error("failed to get event subs: ", err)
 				continue
 			}
 			ctx, cancel = context.WithTimeout(gCtx, time.Second*10)
-			cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionUsers).Find(ctx, bson.M{})
+			users, err := eventSubUsers(gCtx, ctx)
 			cancel()
-			users := []structures.User{}
-			if err == nil {
-				ctx, cancel = context.WithTimeout(gCtx, time.Second*10)
-				err = cur.All(ctx, &users)
-				cancel()
-				if err != nil {
-					logrus.Error("failed to get users: ", err)
-					continue
-				}
+			if err != nil {
+				logrus.Error("failed to get users: ", err)
+				continue
 			}
 
-			userMp := map[string]bool{}
+			wanted := map[string]bool{}
 			for _, v := range users {
-				userMp[v.Twitch.ID] = true
+				for _, t := range eventSubTypes {
+					wanted[t+":"+v.Twitch.ID] = true
+				}
 			}
 
 			deleteIDs := []string{}
 			for _, v := range subs {
-				if v.Status != "enabled" || !userMp[v.Condition.BroadcasterUserID] {
+				key := v.Type + ":" + v.Condition.BroadcasterUserID
+				if v.Status != "enabled" || !wanted[key] {
 					deleteIDs = append(deleteIDs, v.ID)
 				} else {
-					delete(userMp, v.Condition.BroadcasterUserID)
+					delete(wanted, key)
 				}
 			}
 
 			for _, v := range deleteIDs {
 				ctx, cancel = context.WithTimeout(gCtx, time.Second*10)
-				err = twitch.DeleteEventSub(gCtx, ctx, v)
+				err = gCtx.Inst().Twitch.DeleteEventSub(ctx, v)
 				cancel()
-				if err != nil {
+				if err != nil && !twitch.IsStatus(err, http.StatusNotFound) {
 					logrus.Errorf("failed to delete webhook %s: %s", v, err.Error())
 				}
 			}
 
-			for uid := range userMp {
+			for _, v := range subs {
+				if v.Status != "enabled" || wanted[v.Type+":"+v.Condition.BroadcasterUserID] {
+					continue
+				}
+
 				ctx, cancel = context.WithTimeout(gCtx, time.Second*10)
-				_, err = twitch.CreateEventSub(gCtx, ctx, helix.EventSubSubscription{
-					Type:    "channel.update",
-					Version: "1",
-					Condition: helix.EventSubCondition{
-						BroadcasterUserID: uid,
-					},
-					Transport: helix.EventSubTransport{
-						Method:   "webhook",
-						Callback: gCtx.Config().Twitch.Webhook.CallbackURL,
-						Secret:   gCtx.Config().Twitch.Webhook.Secret,
-					},
+				err = recordEventSub(gCtx, ctx, structures.EventSubSubscription{
+					Type:              v.Type,
+					BroadcasterUserID: v.Condition.BroadcasterUserID,
+					TwitchID:          v.ID,
+					Status:            v.Status,
+					Transport:         v.Transport.Method,
 				})
 				cancel()
 				if err != nil {
-					logrus.Errorf("failed to create webhook for %s: %s", uid, err.Error())
+					logrus.Error("failed to record webhook: ", err)
+				}
+			}
+
+			for key := range wanted {
+				splits := strings.SplitN(key, ":", 2)
+				ctx, cancel = context.WithTimeout(gCtx, time.Second*10)
+				_, err = createEventSub(gCtx, ctx, webhookTransport(gCtx), splits[0], splits[1])
+				cancel()
+				if err != nil {
+					logrus.Errorf("failed to create webhook %s for %s: %s", splits[0], splits[1], err.Error())
 				}
 			}
+
+			ctx, cancel = context.WithTimeout(gCtx, time.Second*10)
+			if err = deleteEventSubRecords(gCtx, ctx, users); err != nil {
+				logrus.Error("failed to remove old webhook records: ", err)
+			}
+			reportEventSubs(gCtx, ctx)
+			cancel()
 		}
 	}()
 
@@ -162,7 +180,7 @@ func WebhookTwitchHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
 			return
 		}
 
-		set, err := gCtx.Inst().Redis.SetNX(ctx, fmt.Sprintf("twitch-webhook-events:%s", ctx.Request.Header.Peek("Twitch-Eventsub-Message-Id")), "1", time.Hour*12)
+		set, err := markEventSubMessage(gCtx, ctx, utils.B2S(ctx.Request.Header.Peek("Twitch-Eventsub-Message-Id")))
 		if err != nil {
 			logrus.Error("redis failed to set webhook event: ", err)
 			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
@@ -184,88 +202,7 @@ func WebhookTwitchHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
 				return
 			}
 
-			user := structures.User{}
-			res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{
-				"twitch.id": body.Subscription.Condition.BroadcasterUserID,
-			})
-			err = res.Err()
-			if err == nil {
-				err = res.Decode(&user)
-			}
-			if err != nil {
-				if err == mongo.ErrNoDocuments {
-					ctx.SetStatusCode(fasthttp.StatusNotFound)
-				} else {
-					logrus.Errorf("error on mongo webhook lookup: %s", err.Error())
-					ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-				}
-				return
-			}
-
-			vodID, err := gCtx.Inst().Redis.Get(ctx, "streamer-live:"+user.ID.Hex())
-			if err != nil {
-				if err == redis.Nil {
-					ctx.SetStatusCode(fasthttp.StatusOK)
-					return
-				}
-
-				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-				logrus.Error("failed to check streamer live: ", err)
-				return
-			}
-
-			vID, err := primitive.ObjectIDFromHex(vodID.(string))
-			if err != nil {
-				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-				logrus.Error("bad resp from redis: ", vodID)
-				return
-			}
-
-			vod := structures.Vod{}
-			res = gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOne(ctx, bson.M{
-				"_id": vID,
-			})
-			err = res.Err()
-			if err == nil {
-				err = res.Decode(&vod)
-			}
-			if err != nil {
-				logrus.Errorf("error on mongo webhook lookup: %s", err.Error())
-				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-				return
-			}
-			update := bson.M{
-				"$set": bson.M{
-					"title": body.Event.Title,
-				},
-			}
-			if len(vod.Categories) == 0 || vod.Categories[len(vod.Categories)-1].ID != body.Event.CategoryID {
-				url := fmt.Sprintf("https://static-cdn.jtvnw.net/ttv-boxart/%s-144x192.jpg", body.Event.CategoryID)
-				if body.Event.CategoryName == "" {
-					body.Event.CategoryName = "Unknown"
-					body.Event.CategoryID = "0"
-					url = "https://static-cdn.jtvnw.net/ttv-static/404_boxart.jpg"
-				}
-				update["$push"] = bson.M{
-					"categories": structures.VodCategory{
-						Timestamp: time.Now(),
-						Name:      body.Event.CategoryName,
-						ID:        body.Event.CategoryID,
-						URL:       url,
-					},
-				}
-			}
-
-			_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).UpdateOne(ctx, bson.M{
-				"_id": vID,
-			}, update)
-			if err != nil {
-				logrus.Error("failed to update vod: ", err)
-				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-				return
-			}
-
-			ctx.SetStatusCode(fasthttp.StatusNoContent)
+			ctx.SetStatusCode(handleNotification(gCtx, ctx, body))
 		case "webhook_callback_verification":
 			// we need to verify the webhook
 			body := WebhookVerifyPending{}
@@ -275,12 +212,222 @@ func WebhookTwitchHandler(gCtx global.Context) func(ctx *fasthttp.RequestCtx) {
 				return
 			}
 
+			if err := recordEventSub(gCtx, ctx, structures.EventSubSubscription{
+				Type:              body.Subscription.Type,
+				BroadcasterUserID: body.Subscription.Condition.BroadcasterUserID,
+				TwitchID:          body.Subscription.ID,
+				Status:            "enabled",
+				Transport:         body.Subscription.Transport.Method,
+			}); err != nil {
+				logrus.Error("failed to record webhook: ", err)
+			}
+
 			ctx.SetStatusCode(fasthttp.StatusOK)
 			ctx.SetBodyString(body.Challenge)
 		case "revocation":
+			body := WebhookNotification{}
+			if err := json.Unmarshal(ctx.Request.Body(), &body); err != nil {
+				logrus.Errorf("bad body from twitch: %s : %s", err.Error(), ctx.Request.Body())
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+				return
+			}
+
+			// recreating the subscription makes twitch call us back, so it cant happen inside this request
+			go handleRevocation(gCtx, body.Subscription, webhookTransport(gCtx))
 			ctx.SetStatusCode(fasthttp.StatusNoContent)
 		default:
 			ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		}
 	}
 }
+
+// handleNotification applies an eventsub notification and returns the status code to respond with.
+func handleNotification(gCtx global.Context, ctx context.Context, body WebhookNotification) int {
+	user := structures.User{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{
+		"twitch.id": body.Subscription.Condition.BroadcasterUserID,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&user)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fasthttp.StatusNotFound
+		}
+
+		logrus.Errorf("error on mongo webhook lookup: %s", err.Error())
+		return fasthttp.StatusInternalServerError
+	}
+
+	switch body.Subscription.Type {
+	case "channel.update":
+		return handleChannelUpdate(gCtx, ctx, user, body)
+	case "stream.online":
+		return handleStreamOnline(gCtx, ctx, user, body)
+	case "stream.offline":
+		return handleStreamOffline(gCtx, ctx, user)
+	}
+
+	logrus.Warn("unknown eventsub notification type: ", body.Subscription.Type)
+	return fasthttp.StatusNoContent
+}
+
+func handleChannelUpdate(gCtx global.Context, ctx context.Context, user structures.User, body WebhookNotification) int {
+	vodID, err := gCtx.Inst().Redis.Get(ctx, "streamer-live:"+user.ID.Hex())
+	if err != nil {
+		if err == redis.Nil {
+			return fasthttp.StatusOK
+		}
+
+		logrus.Error("failed to check streamer live: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	vID, err := primitive.ObjectIDFromHex(vodID.(string))
+	if err != nil {
+		logrus.Error("bad resp from redis: ", vodID)
+		return fasthttp.StatusInternalServerError
+	}
+
+	vod := structures.Vod{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOne(ctx, bson.M{
+		"_id": vID,
+	})
+	err = res.Err()
+	if err == nil {
+		err = res.Decode(&vod)
+	}
+	if err != nil {
+		logrus.Errorf("error on mongo webhook lookup: %s", err.Error())
+		return fasthttp.StatusInternalServerError
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"title": body.Event.Title,
+		},
+	}
+	push := bson.M{}
+	last := structures.VodTitle{}
+	if len(vod.Titles) != 0 {
+		last = vod.Titles[len(vod.Titles)-1]
+	}
+	if len(vod.Titles) == 0 || last.Title != body.Event.Title || last.Language != body.Event.Language || last.IsMature != body.Event.IsMature {
+		push["titles"] = structures.VodTitle{
+			Timestamp: time.Now(),
+			Title:     body.Event.Title,
+			Language:  body.Event.Language,
+			IsMature:  body.Event.IsMature,
+		}
+	}
+	category := resolveCategory(gCtx, ctx, body.Event.CategoryID, body.Event.CategoryName)
+	if len(vod.Categories) == 0 || vod.Categories[len(vod.Categories)-1].ID != category.ID {
+		push["categories"] = structures.VodCategory{
+			Timestamp: time.Now(),
+			Name:      category.Name,
+			ID:        category.ID,
+			URL:       category.BoxArt(144, 192),
+		}
+	}
+	if len(push) != 0 {
+		update["$push"] = push
+	}
+
+	_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).UpdateOne(ctx, bson.M{
+		"_id": vID,
+	}, update)
+	if err != nil {
+		logrus.Error("failed to update vod: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	return fasthttp.StatusNoContent
+}
+
+func handleStreamOnline(gCtx global.Context, ctx context.Context, user structures.User, body WebhookNotification) int {
+	startedAt := body.Event.StartedAt
+	if startedAt.IsZero() {
+		startedAt = time.Now()
+	}
+
+	stream := structures.Stream{
+		UserID: user.ID,
+		Twitch: structures.StreamTwitch{
+			ID:   body.Event.ID,
+			Type: body.Event.Type,
+		},
+		StartedAt: startedAt,
+	}
+
+	vod := structures.Vod{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOne(ctx, bson.M{
+		"user_id":   user.ID,
+		"vod_state": structures.VodStateLive,
+	}, options.FindOne().SetSort(bson.M{"started_at": -1}))
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&vod)
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		logrus.Error("failed to find live vod: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	if !vod.ID.IsZero() {
+		stream.VodID = vod.ID
+
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).UpdateOne(ctx, bson.M{
+			"_id": vod.ID,
+		}, bson.M{
+			"$set": bson.M{
+				"twitch_stream_id": body.Event.ID,
+			},
+		}); err != nil {
+			logrus.Error("failed to update vod: ", err)
+			return fasthttp.StatusInternalServerError
+		}
+
+		if err := gCtx.Inst().Redis.SetEX(ctx, "streamer-live:"+user.ID.Hex(), vod.ID.Hex(), time.Hour*48); err != nil {
+			logrus.Error("failed to mark streamer live: ", err)
+			return fasthttp.StatusInternalServerError
+		}
+	} else {
+		logrus.WithField("user_id", user.ID.Hex()).Info("stream went online without a live vod")
+	}
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionStreams).UpdateOne(ctx, bson.M{
+		"user_id":   user.ID,
+		"twitch.id": body.Event.ID,
+	}, bson.M{
+		"$setOnInsert": stream,
+	}, options.Update().SetUpsert(true)); err != nil {
+		logrus.Error("failed to record stream: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	return fasthttp.StatusNoContent
+}
+
+func handleStreamOffline(gCtx global.Context, ctx context.Context, user structures.User) int {
+	now := time.Now()
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionStreams).UpdateMany(ctx, bson.M{
+		"user_id":  user.ID,
+		"ended_at": time.Time{},
+	}, bson.M{
+		"$set": bson.M{
+			"ended_at": now,
+		},
+	}); err != nil {
+		logrus.Error("failed to end stream: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	// on_publish_done may never come when the ingest server goes away, the vods are queued here as well
+	if err := ingest.EndLiveVods(gCtx, ctx, user.ID); err != nil {
+		logrus.Error("failed to end live vods: ", err)
+		return fasthttp.StatusInternalServerError
+	}
+
+	return fasthttp.StatusNoContent
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -32,6 +33,7 @@ func New() *Config {
 
 	pflag.String("config", "config.yaml", "Config file location")
 	pflag.Bool("noheader", false, "Disable the startup header")
+	pflag.String("migrate", "", "Run a one-off migration and exit")
 	pflag.Parse()
 	checkErr(config.BindPFlags(pflag.CommandLine))
 
@@ -86,10 +88,36 @@ type Config struct {
 	Level      string `mapstructure:"level" json:"level"`
 	ConfigFile string `mapstructure:"config" json:"config"`
 	NoHeader   bool   `mapstructure:"noheader" json:"noheader"`
+	Migrate    string `mapstructure:"migrate" json:"migrate"`
 
 	API struct {
 		Bind        string `mapstructure:"bind" json:"bind"`
 		RawVodsPath string `mapstructure:"raw_vods_path" json:"raw_vods_path"`
+		AdminToken  string `mapstructure:"admin_token" json:"admin_token"`
+		// RTMPHookSecret must be passed as the secret query param by the ingest server when set
+		RTMPHookSecret string `mapstructure:"rtmp_hook_secret" json:"rtmp_hook_secret"`
+		// RTMPDrop is called to kick a publisher off the ingest server when its stream key is revoked,
+		// {client_id} and {app} in the url are replaced with the values of the publish
+		RTMPDrop struct {
+			URL    string `mapstructure:"url" json:"url"`
+			Method string `mapstructure:"method" json:"method"`
+		} `mapstructure:"rtmp_drop" json:"rtmp_drop"`
+		// PublicURL is where clients reach the api, media urls are relative without it
+		PublicURL string `mapstructure:"public_url" json:"public_url"`
+		// ClientIPHeader is trusted to hold the ip of the client when set, for when the api runs behind a proxy
+		ClientIPHeader string `mapstructure:"client_ip_header" json:"client_ip_header"`
+		// TrustedProxies is the number of proxies that append to the client ip header, the client ip is taken
+		// from that many entries from the right since the entries before them are sent by the client (default 1)
+		TrustedProxies int `mapstructure:"trusted_proxies" json:"trusted_proxies"`
+		// MediaSigning protects the media of vods with urls that are signed for a while
+		MediaSigning struct {
+			Secret string        `mapstructure:"secret" json:"secret"`
+			TTL    time.Duration `mapstructure:"ttl" json:"ttl"`
+			// BindIP only accepts a signed url from the ip it was handed out to
+			BindIP bool `mapstructure:"bind_ip" json:"bind_ip"`
+			// Visibilities lists the visibilities of the vods that are only served on signed urls
+			Visibilities []string `mapstructure:"visibilities" json:"visibilities"`
+		} `mapstructure:"media_signing" json:"media_signing"`
 	} `mapstructure:"api" json:"api"`
 
 	Pod struct {
@@ -104,8 +132,27 @@ type Config struct {
 
 	RMQ struct {
 		URI string `mapstructure:"uri" json:"uri"`
+		// Prefetch is how many unacknowledged messages a consumer holds at once
+		Prefetch int `mapstructure:"prefetch" json:"prefetch"`
+		// ChannelPoolSize is how many idle publish channels are kept open
+		ChannelPoolSize int `mapstructure:"channel_pool_size" json:"channel_pool_size"`
 	} `mapstructure:"rmq" json:"rmq"`
 
+	Transcode struct {
+		JobQueue    string `mapstructure:"job_queue" json:"job_queue"`
+		UpdateQueue string `mapstructure:"update_queue" json:"update_queue"`
+		// DeadLetterExchange routes rejected jobs and updates to the .dead queue of their queue
+		DeadLetterExchange string `mapstructure:"dead_letter_exchange" json:"dead_letter_exchange"`
+		// MaxAttempts is how often a variant is transcoded before it fails
+		MaxAttempts int `mapstructure:"max_attempts" json:"max_attempts"`
+		// RetryBackoff is the delay of the first retry, it doubles with every retry after
+		RetryBackoff time.Duration `mapstructure:"retry_backoff" json:"retry_backoff"`
+		// Ladder holds the names of the variants vods are transcoded to unless the user picked their own
+		Ladder []string `mapstructure:"ladder" json:"ladder"`
+		// Variants are added to the presets, a variant replaces the preset with the same name
+		Variants []TranscodeVariant `mapstructure:"variants" json:"variants"`
+	} `mapstructure:"transcode" json:"transcode"`
+
 	Redis struct {
 		Username   string   `mapstructure:"username" json:"username"`
 		Password   string   `mapstructure:"password" json:"password"`
@@ -127,20 +174,52 @@ type Config struct {
 	} `mapstructure:"health" json:"health"`
 
 	TwitchChat struct {
-		Enabled bool `mapstructure:"enabled" json:"enabled"`
+		Enabled       bool `mapstructure:"enabled" json:"enabled"`
+		JoinRateLimit int  `mapstructure:"join_rate_limit" json:"join_rate_limit"`
+		Writer        struct {
+			QueueSize     int           `mapstructure:"queue_size" json:"queue_size"`
+			FlushSize     int           `mapstructure:"flush_size" json:"flush_size"`
+			FlushInterval time.Duration `mapstructure:"flush_interval" json:"flush_interval"`
+		} `mapstructure:"writer" json:"writer"`
 	} `mapstructure:"twitch_chat" json:"twitch_chat"`
 
+	Emotes struct {
+		BttvURL         string        `mapstructure:"bttv_url" json:"bttv_url"`
+		FFZURL          string        `mapstructure:"ffz_url" json:"ffz_url"`
+		SevenTVURL      string        `mapstructure:"seventv_url" json:"seventv_url"`
+		RefreshInterval time.Duration `mapstructure:"refresh_interval" json:"refresh_interval"`
+	} `mapstructure:"emotes" json:"emotes"`
+
 	Twitch struct {
 		ClientID     string `mapstructure:"client_id" json:"client_id"`
 		ClientSecret string `mapstructure:"client_secret" json:"client_secret"`
+		HelixURL     string `mapstructure:"helix_url" json:"helix_url"`
+		AuthURL      string `mapstructure:"auth_url" json:"auth_url"`
 		RedirectURL  string `mapstructure:"redirect_url" json:"redirect_url"`
 		Webhook      struct {
 			Secret      string `mapstructure:"secret" json:"secret"`
 			CallbackURL string `mapstructure:"callback_url" json:"callback_url"`
 		} `mapstructure:"webhook" json:"webhook"`
+		EventSub struct {
+			// Transport is either webhook or websocket, webhook is used when empty
+			Transport    string `mapstructure:"transport" json:"transport"`
+			WebsocketURL string `mapstructure:"websocket_url" json:"websocket_url"`
+			// RefreshToken is a user refresh token, websocket subscriptions cannot be made with an app token
+			RefreshToken string `mapstructure:"refresh_token" json:"refresh_token"`
+		} `mapstructure:"eventsub" json:"eventsub"`
 	} `mapstructure:"twitch" json:"twitch"`
 }
 
+type TranscodeVariant struct {
+	Name    string `mapstructure:"name" json:"name"`
+	Width   int    `mapstructure:"width" json:"width"`
+	Height  int    `mapstructure:"height" json:"height"`
+	FPS     int    `mapstructure:"fps" json:"fps"`
+	Bitrate int    `mapstructure:"bitrate" json:"bitrate"`
+	// AudioOnly variants drop the video
+	AudioOnly bool `mapstructure:"audio_only" json:"audio_only"`
+}
+
 type KeyValue struct {
 	Key   string `mapstructure:"key" json:"key"`
 	Value string `mapstructure:"value" json:"value"`
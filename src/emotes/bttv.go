@@ -0,0 +1,78 @@
+package emotes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type BttvEmote struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+}
+
+type BttvChannel struct {
+	ChannelEmotes []BttvEmote `json:"channelEmotes"`
+	SharedEmotes  []BttvEmote `json:"sharedEmotes"`
+}
+
+type bttvProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewBttvProvider(client *http.Client, baseURL string) EmoteProvider {
+	return &bttvProvider{
+		client:  client,
+		baseURL: baseURL,
+	}
+}
+
+func (p *bttvProvider) Name() EmoteProviderName {
+	return EmoteProviderBTTV
+}
+
+func (p *bttvProvider) Global(ctx context.Context) ([]Emote, error) {
+	bttvGlobalEmotes := []BttvEmote{}
+	if err := getJSON(ctx, p.client, p.baseURL+"/cached/emotes/global", &bttvGlobalEmotes); err != nil {
+		return nil, err
+	}
+
+	emotes := []Emote{}
+	for _, v := range bttvGlobalEmotes {
+		emotes = append(emotes, bttvEmote(v))
+	}
+
+	return emotes, nil
+}
+
+func (p *bttvProvider) Channel(ctx context.Context, id string) ([]Emote, error) {
+	channel := BttvChannel{}
+	if err := getJSON(ctx, p.client, p.baseURL+"/cached/users/twitch/"+id, &channel); err != nil {
+		return nil, err
+	}
+
+	emotes := []Emote{}
+	for _, v := range channel.ChannelEmotes {
+		emotes = append(emotes, bttvEmote(v))
+	}
+
+	for _, v := range channel.SharedEmotes {
+		emotes = append(emotes, bttvEmote(v))
+	}
+
+	return emotes, nil
+}
+
+func bttvEmote(v BttvEmote) Emote {
+	return Emote{
+		ID:   v.ID,
+		Name: v.Code,
+		URLs: []string{
+			fmt.Sprintf("https://cdn.betterttv.net/emote/%s/1x", v.ID),
+			fmt.Sprintf("https://cdn.betterttv.net/emote/%s/2x", v.ID),
+			fmt.Sprintf("https://cdn.betterttv.net/emote/%s/3x", v.ID),
+		},
+		Provider: EmoteProviderBTTV,
+	}
+}
@@ -5,376 +5,49 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"time"
+	"strings"
 
-	"github.com/AdmiralBulldogTv/VodApi/src/global"
-	"github.com/go-redis/redis/v8"
 	jsoniter "github.com/json-iterator/go"
-	"github.com/sirupsen/logrus"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
-type BttvEmote struct {
-	ID   string `json:"id"`
-	Code string `json:"code"`
-}
-
-type BttvChannel struct {
-	ChannelEmotes []BttvEmote `json:"channelEmotes"`
-	SharedEmotes  []BttvEmote `json:"sharedEmotes"`
-}
-
-func GetBttv(gCtx global.Context, ctx context.Context, id string) ([]Emote, error) {
-	resp, err := gCtx.Inst().Redis.Get(ctx, "emotes-cached:bttv:"+id)
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		if err != redis.Nil {
-			logrus.Warn("failed to fetched cached bttv emotes: ", err)
-		}
-	} else {
-		emotes := []Emote{}
-		if err := json.UnmarshalFromString(resp.(string), &emotes); err != nil {
-			logrus.Warn("bad cache value for bttv emotes: ", err)
-		} else {
-			return emotes, nil
-		}
-	}
-
-	bttvGlobalEmotes := []BttvEmote{}
-	{
-		req, err := http.NewRequestWithContext(ctx, "GET", "https://api.betterttv.net/3/cached/emotes/global", nil)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		if err := json.Unmarshal(data, &bttvGlobalEmotes); err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-	}
-
-	channel := BttvChannel{}
-	{
-		req, err := http.NewRequestWithContext(ctx, "GET", "https://api.betterttv.net/3/cached/users/twitch/"+id, nil)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		if err := json.Unmarshal(data, &channel); err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:bttv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-	}
-
-	emotes := []Emote{}
-	for _, v := range bttvGlobalEmotes {
-		emotes = append(emotes, Emote{
-			ID:   v.ID,
-			Name: v.Code,
-			URLs: []string{
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/1x", v.ID),
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/2x", v.ID),
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/3x", v.ID),
-			},
-			Provider: EmoteProviderBTTV,
-		})
-	}
-
-	for _, v := range channel.ChannelEmotes {
-		emotes = append(emotes, Emote{
-			ID:   v.ID,
-			Name: v.Code,
-			URLs: []string{
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/1x", v.ID),
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/2x", v.ID),
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/3x", v.ID),
-			},
-			Provider: EmoteProviderBTTV,
-		})
-	}
-
-	for _, v := range channel.SharedEmotes {
-		emotes = append(emotes, Emote{
-			ID:   v.ID,
-			Name: v.Code,
-			URLs: []string{
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/1x", v.ID),
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/2x", v.ID),
-				fmt.Sprintf("https://cdn.betterttv.net/emote/%s/3x", v.ID),
-			},
-			Provider: EmoteProviderBTTV,
-		})
-	}
-
-	data, _ := json.MarshalToString(emotes)
-	if err = gCtx.Inst().Redis.SetEX(ctx, "emotes-cached:bttv:"+id, data, time.Minute*30); err != nil {
-		logrus.Warn("failed to set emote bttv cache: ", err)
+		return err
 	}
 
-	return emotes, nil
-}
-
-type FFZRoom struct {
-	Sets map[string]FFZEmoteSet `json:"sets"`
-}
-
-type FFZEmoteSet struct {
-	Emoticons []FFZEmote `json:"emoticons"`
-}
-
-type FFZEmote struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-}
-
-func GetFFZ(gCtx global.Context, ctx context.Context, id string) ([]Emote, error) {
-	resp, err := gCtx.Inst().Redis.Get(ctx, "emotes-cached:ffz:"+id)
+	resp, err := client.Do(req)
 	if err != nil {
-		if err != redis.Nil {
-			logrus.Warn("failed to fetched cached ffz emotes: ", err)
-		}
-	} else {
-		emotes := []Emote{}
-		if err := json.UnmarshalFromString(resp.(string), &emotes); err != nil {
-			logrus.Warn("bad cache value for ffz emotes: ", err)
-		} else {
-			return emotes, nil
-		}
-	}
-
-	ffzGlobalRoom := FFZRoom{}
-	{
-		req, err := http.NewRequestWithContext(ctx, "GET", "https://api.frankerfacez.com/v1/set/global", nil)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		if err := json.Unmarshal(data, &ffzGlobalRoom); err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
+		return err
 	}
+	defer resp.Body.Close()
 
-	channelRoom := FFZRoom{}
-	{
-		req, err := http.NewRequestWithContext(ctx, "GET", "https://api.frankerfacez.com/v1/room/id/"+id, nil)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		if err := json.Unmarshal(data, &channelRoom); err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:ffz:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-	}
-
-	emotes := []Emote{}
-	for _, s := range ffzGlobalRoom.Sets {
-		for _, v := range s.Emoticons {
-			emotes = append(emotes, Emote{
-				ID:   fmt.Sprint(v.ID),
-				Name: v.Name,
-				URLs: []string{
-					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/1", v.ID),
-					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/2", v.ID),
-					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/3", v.ID),
-				},
-				Provider: EmoteProviderFFZ,
-			})
-		}
+	// providers answer with a 404 when a channel has never set up emotes
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
 	}
 
-	for _, s := range channelRoom.Sets {
-		for _, v := range s.Emoticons {
-			emotes = append(emotes, Emote{
-				ID:   fmt.Sprint(v.ID),
-				Name: v.Name,
-				URLs: []string{
-					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/1", v.ID),
-					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/2", v.ID),
-					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/3", v.ID),
-				},
-				Provider: EmoteProviderFFZ,
-			})
-		}
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("bad status resp: %d", resp.StatusCode)
 	}
 
-	data, _ := json.MarshalToString(emotes)
-	if err = gCtx.Inst().Redis.SetEX(ctx, "emotes-cached:ffz:"+id, data, time.Minute*30); err != nil {
-		logrus.Warn("failed to set emote ffz cache: ", err)
-	}
-
-	return emotes, nil
-}
-
-type SeventvEmote struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Visibility int    `json:"visibility"`
-}
-
-func Get7TV(gCtx global.Context, ctx context.Context, id string) ([]Emote, error) {
-	resp, err := gCtx.Inst().Redis.Get(ctx, "emotes-cached:7tv:"+id)
+	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		if err != redis.Nil {
-			logrus.Warn("failed to fetched cached 7tv emotes: ", err)
-		}
-	} else {
-		emotes := []Emote{}
-		if err := json.UnmarshalFromString(resp.(string), &emotes); err != nil {
-			logrus.Warn("bad cache value for 7tv emotes: ", err)
-		} else {
-			return emotes, nil
-		}
-	}
-
-	seventvGlobal := []SeventvEmote{}
-	{
-		req, err := http.NewRequestWithContext(ctx, "GET", "https://api.7tv.app/v2/emotes/global", nil)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		if err := json.Unmarshal(data, &seventvGlobal); err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-	}
-
-	channel := []SeventvEmote{}
-	{
-		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.7tv.app/v2/users/%s/emotes", id), nil)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		data, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
-
-		if err := json.Unmarshal(data, &channel); err != nil {
-			_, _ = gCtx.Inst().Redis.SetNX(ctx, "emotes-cached:7tv:"+id, "[]", time.Second*30)
-			return nil, err
-		}
+		return err
 	}
 
-	emotes := []Emote{}
-	for _, v := range seventvGlobal {
-		emotes = append(emotes, Emote{
-			ID:   v.ID,
-			Name: v.Name,
-			URLs: []string{
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/1x", v.ID),
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/2x", v.ID),
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/3x", v.ID),
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/4x", v.ID),
-			},
-			ZeroWidth: v.Visibility&128 != 0,
-			Provider:  EmoteProvider7TV,
-		})
-	}
-
-	for _, v := range channel {
-		emotes = append(emotes, Emote{
-			ID:   v.ID,
-			Name: v.Name,
-			URLs: []string{
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/1x", v.ID),
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/2x", v.ID),
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/3x", v.ID),
-				fmt.Sprintf("https://cdn.7tv.app/emote/%s/4x", v.ID),
-			},
-			Provider:  EmoteProvider7TV,
-			ZeroWidth: v.Visibility&128 != 0,
-		})
-	}
-
-	data, _ := json.MarshalToString(emotes)
-	if err = gCtx.Inst().Redis.SetEX(ctx, "emotes-cached:7tv:"+id, data, time.Minute*30); err != nil {
-		logrus.Warn("failed to set emote ffz cache: ", err)
-	}
+	return json.Unmarshal(data, v)
+}
 
-	return emotes, nil
+// EmoteProvider is a third party emote service.
+type EmoteProvider interface {
+	Name() EmoteProviderName
+	// Global returns the emotes which are available in every channel.
+	Global(ctx context.Context) ([]Emote, error)
+	// Channel returns the emotes of a single channel by its twitch id.
+	Channel(ctx context.Context, channelID string) ([]Emote, error)
 }
 
 type Emote struct {
@@ -382,14 +55,27 @@ type Emote struct {
 	Name      string
 	URLs      []string
 	ZeroWidth bool
-	Provider  EmoteProvider
+	Provider  EmoteProviderName
 }
 
-type EmoteProvider string
+type EmoteProviderName string
 
 const (
-	EmoteProviderTwitch EmoteProvider = "TWITCH"
-	EmoteProviderFFZ    EmoteProvider = "FFZ"
-	EmoteProviderBTTV   EmoteProvider = "BTTV"
-	EmoteProvider7TV    EmoteProvider = "7TV"
+	EmoteProviderFFZ  EmoteProviderName = "FFZ"
+	EmoteProviderBTTV EmoteProviderName = "BTTV"
+	EmoteProvider7TV  EmoteProviderName = "7TV"
 )
+
+// DefaultProviderPrecedence is used for channels which have not configured their providers, earlier providers win when names collide.
+var DefaultProviderPrecedence = []EmoteProviderName{EmoteProvider7TV, EmoteProviderBTTV, EmoteProviderFFZ}
+
+// ParseProviderName returns the provider registered under the name, regardless of its case.
+func ParseProviderName(name string) (EmoteProviderName, bool) {
+	for _, p := range DefaultProviderPrecedence {
+		if strings.EqualFold(string(p), name) {
+			return p, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,69 @@
+package emotes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type FFZRoom struct {
+	Sets map[string]FFZEmoteSet `json:"sets"`
+}
+
+type FFZEmoteSet struct {
+	Emoticons []FFZEmote `json:"emoticons"`
+}
+
+type FFZEmote struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type ffzProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewFFZProvider(client *http.Client, baseURL string) EmoteProvider {
+	return &ffzProvider{
+		client:  client,
+		baseURL: baseURL,
+	}
+}
+
+func (p *ffzProvider) Name() EmoteProviderName {
+	return EmoteProviderFFZ
+}
+
+func (p *ffzProvider) Global(ctx context.Context) ([]Emote, error) {
+	return p.room(ctx, p.baseURL+"/set/global")
+}
+
+func (p *ffzProvider) Channel(ctx context.Context, id string) ([]Emote, error) {
+	return p.room(ctx, p.baseURL+"/room/id/"+id)
+}
+
+func (p *ffzProvider) room(ctx context.Context, url string) ([]Emote, error) {
+	room := FFZRoom{}
+	if err := getJSON(ctx, p.client, url, &room); err != nil {
+		return nil, err
+	}
+
+	emotes := []Emote{}
+	for _, s := range room.Sets {
+		for _, v := range s.Emoticons {
+			emotes = append(emotes, Emote{
+				ID:   fmt.Sprint(v.ID),
+				Name: v.Name,
+				URLs: []string{
+					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/1", v.ID),
+					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/2", v.ID),
+					fmt.Sprintf("https://cdn.frankerfacez.com/emote/%d/3", v.ID),
+				},
+				Provider: EmoteProviderFFZ,
+			})
+		}
+	}
+
+	return emotes, nil
+}
@@ -0,0 +1,246 @@
+package emotes
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/sirupsen/logrus"
+)
+
+// Registry keeps the emotes of every channel in memory.
+// Sets are served stale while they are refreshed in the background, and a failed refresh keeps the previous set.
+type Registry struct {
+	gCtx global.Context
+
+	ttl   time.Duration
+	retry time.Duration
+
+	mtx           sync.Mutex
+	providers     map[EmoteProviderName]EmoteProvider
+	global        *emoteSet
+	globalVersion int
+	channels      map[string]*emoteSet
+}
+
+type emoteSet struct {
+	providers map[EmoteProviderName][]Emote
+	expiresAt time.Time
+
+	refreshing bool
+	// dirty is set when the providers change during a refresh, so the set is fetched again right after
+	dirty bool
+
+	// precedence is only used for channel sets, earlier providers win when names collide
+	precedence []EmoteProviderName
+
+	merged        map[string]Emote
+	globalVersion int
+}
+
+func NewRegistry(gCtx global.Context) *Registry {
+	cfg := gCtx.Config().Emotes
+
+	ttl := cfg.RefreshInterval
+	if ttl <= 0 {
+		ttl = time.Minute * 30
+	}
+
+	r := &Registry{
+		gCtx:      gCtx,
+		ttl:       ttl,
+		retry:     time.Second * 30,
+		providers: map[EmoteProviderName]EmoteProvider{},
+		global:    newEmoteSet(),
+		channels:  map[string]*emoteSet{},
+	}
+
+	client := &http.Client{Timeout: time.Second * 10}
+	r.Register(NewFFZProvider(client, orDefault(cfg.FFZURL, "https://api.frankerfacez.com/v1")))
+	r.Register(NewBttvProvider(client, orDefault(cfg.BttvURL, "https://api.betterttv.net/3")))
+	r.Register(New7TVProvider(client, orDefault(cfg.SevenTVURL, "https://api.7tv.app/v2")))
+
+	return r
+}
+
+func orDefault(s string, def string) string {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
+
+func newEmoteSet() *emoteSet {
+	return &emoteSet{
+		providers: map[EmoteProviderName][]Emote{},
+	}
+}
+
+// Register adds a provider or replaces the provider with the same name.
+func (r *Registry) Register(p EmoteProvider) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.providers[p.Name()] = p
+	r.global.expiresAt = time.Time{}
+	for _, set := range r.channels {
+		set.expiresAt = time.Time{}
+	}
+}
+
+// Configure sets which providers are enabled for a channel and their precedence,
+// a nil list falls back to DefaultProviderPrecedence while an empty list disables every provider.
+// It also starts loading the emotes of the channel so they are ready before its first message.
+func (r *Registry) Configure(channelID string, precedence []EmoteProviderName) {
+	if precedence == nil {
+		precedence = DefaultProviderPrecedence
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	set := r.channel(channelID)
+	if !equalPrecedence(set.precedence, precedence) {
+		set.precedence = precedence
+		set.merged = nil
+		// newly enabled providers need to be fetched
+		set.expiresAt = time.Time{}
+		set.dirty = set.refreshing
+	}
+
+	r.revalidate(r.global, "")
+	r.revalidate(set, channelID)
+}
+
+// Get returns the merged emotes for a channel keyed by name.
+// The returned map must not be modified.
+func (r *Registry) Get(channelID string) map[string]Emote {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.revalidate(r.global, "")
+
+	set := r.channel(channelID)
+	r.revalidate(set, channelID)
+
+	if set.merged == nil || set.globalVersion != r.globalVersion {
+		// channel emotes win over global ones of any provider
+		merged := map[string]Emote{}
+		for i := len(set.precedence) - 1; i >= 0; i-- {
+			for _, v := range r.global.providers[set.precedence[i]] {
+				merged[v.Name] = v
+			}
+		}
+		for i := len(set.precedence) - 1; i >= 0; i-- {
+			for _, v := range set.providers[set.precedence[i]] {
+				merged[v.Name] = v
+			}
+		}
+
+		set.merged = merged
+		set.globalVersion = r.globalVersion
+	}
+
+	return set.merged
+}
+
+// channel must be called while holding the lock.
+func (r *Registry) channel(channelID string) *emoteSet {
+	set, ok := r.channels[channelID]
+	if !ok {
+		set = newEmoteSet()
+		set.precedence = DefaultProviderPrecedence
+		r.channels[channelID] = set
+	}
+
+	return set
+}
+
+// revalidate must be called while holding the lock.
+func (r *Registry) revalidate(set *emoteSet, channelID string) {
+	if set.refreshing || time.Now().Before(set.expiresAt) {
+		return
+	}
+
+	providers := []EmoteProvider{}
+	if channelID == "" {
+		for _, p := range r.providers {
+			providers = append(providers, p)
+		}
+	} else {
+		for _, name := range set.precedence {
+			if p, ok := r.providers[name]; ok {
+				providers = append(providers, p)
+			}
+		}
+	}
+
+	set.refreshing = true
+	go r.refresh(set, channelID, providers)
+}
+
+func (r *Registry) refresh(set *emoteSet, channelID string, providers []EmoteProvider) {
+	ctx, cancel := context.WithTimeout(r.gCtx, time.Second*30)
+	defer cancel()
+
+	fetched := map[EmoteProviderName][]Emote{}
+	failed := false
+	for _, p := range providers {
+		var (
+			emotes []Emote
+			err    error
+		)
+		if channelID == "" {
+			emotes, err = p.Global(ctx)
+		} else {
+			emotes, err = p.Channel(ctx, channelID)
+		}
+		if err != nil {
+			logrus.WithField("channel", channelID).Debugf("failed to get %s emotes: %s", p.Name(), err.Error())
+			failed = true
+			continue
+		}
+
+		fetched[p.Name()] = emotes
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for p, emotes := range fetched {
+		set.providers[p] = emotes
+	}
+
+	set.refreshing = false
+	if set.dirty {
+		set.dirty = false
+		set.expiresAt = time.Time{}
+	} else if failed {
+		set.expiresAt = time.Now().Add(r.retry)
+	} else {
+		set.expiresAt = time.Now().Add(r.ttl)
+	}
+
+	if channelID == "" {
+		r.globalVersion++
+	} else {
+		set.merged = nil
+	}
+}
+
+func equalPrecedence(a []EmoteProviderName, b []EmoteProviderName) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,62 @@
+package emotes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type SeventvEmote struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Visibility int    `json:"visibility"`
+}
+
+type seventvProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+func New7TVProvider(client *http.Client, baseURL string) EmoteProvider {
+	return &seventvProvider{
+		client:  client,
+		baseURL: baseURL,
+	}
+}
+
+func (p *seventvProvider) Name() EmoteProviderName {
+	return EmoteProvider7TV
+}
+
+func (p *seventvProvider) Global(ctx context.Context) ([]Emote, error) {
+	return p.emotes(ctx, p.baseURL+"/emotes/global")
+}
+
+func (p *seventvProvider) Channel(ctx context.Context, id string) ([]Emote, error) {
+	return p.emotes(ctx, fmt.Sprintf("%s/users/%s/emotes", p.baseURL, id))
+}
+
+func (p *seventvProvider) emotes(ctx context.Context, url string) ([]Emote, error) {
+	seventvEmotes := []SeventvEmote{}
+	if err := getJSON(ctx, p.client, url, &seventvEmotes); err != nil {
+		return nil, err
+	}
+
+	emotes := []Emote{}
+	for _, v := range seventvEmotes {
+		emotes = append(emotes, Emote{
+			ID:   v.ID,
+			Name: v.Name,
+			URLs: []string{
+				fmt.Sprintf("https://cdn.7tv.app/emote/%s/1x", v.ID),
+				fmt.Sprintf("https://cdn.7tv.app/emote/%s/2x", v.ID),
+				fmt.Sprintf("https://cdn.7tv.app/emote/%s/3x", v.ID),
+				fmt.Sprintf("https://cdn.7tv.app/emote/%s/4x", v.ID),
+			},
+			ZeroWidth: v.Visibility&128 != 0,
+			Provider:  EmoteProvider7TV,
+		})
+	}
+
+	return emotes, nil
+}
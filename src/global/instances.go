@@ -1,10 +1,14 @@
 package global
 
-import "github.com/AdmiralBulldogTv/VodApi/src/instance"
+import (
+	"github.com/AdmiralBulldogTv/VodApi/src/instance"
+	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
+)
 
 type Instances struct {
 	Redis      instance.Redis
 	Mongo      instance.Mongo
 	Prometheus instance.Prometheus
 	RMQ        instance.RMQ
+	Twitch     *twitch.Client
 }
@@ -43,6 +43,12 @@ func New(gCtx global.Context) <-chan struct{} {
 			if err := gCtx.Inst().Mongo.Ping(mongoCtx); err != nil {
 				logrus.Error("mongo down: ", err)
 				ctx.SetStatusCode(503)
+				return
+			}
+
+			if err := gCtx.Inst().RMQ.Status(); err != nil {
+				logrus.Error("rmq down: ", err)
+				ctx.SetStatusCode(503)
 			}
 		},
 		GetOnly:          true,
@@ -8,4 +8,11 @@ type Prometheus interface {
 	Register(prometheus.Registerer)
 	ResponseTimeMilliseconds() prometheus.Histogram
 	TwitchChatMessages() prometheus.Histogram
+	TwitchChatQueueLength() prometheus.Gauge
+	TwitchChatDroppedMessages() prometheus.Counter
+	TwitchChatFlushDurationMilliseconds() prometheus.Histogram
+	TwitchChatFlushSize() prometheus.Histogram
+	TwitchEventSubSubscriptions() *prometheus.GaugeVec
+	RMQConnected() prometheus.Gauge
+	RMQReconnects() prometheus.Counter
 }
@@ -10,8 +10,11 @@ import (
 type Redis interface {
 	Ping(ctx context.Context) error
 	Subscribe(ctx context.Context, ch chan string, subscribeTo ...string)
+	Publish(ctx context.Context, channel string, message interface{}) error
 	Get(ctx context.Context, key string) (interface{}, error)
+	Set(ctx context.Context, key string, value interface{}) error
 	SetEX(ctx context.Context, key string, value interface{}, ttl time.Duration) error
 	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, keys ...string) error
 	Pipeline(ctx context.Context) redis.Pipeliner
 }
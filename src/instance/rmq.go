@@ -1,8 +1,20 @@
 package instance
 
-import "github.com/streadway/amqp"
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
 
 type RMQ interface {
+	// declarations are repeated after a reconnect
+	QueueDeclare(queueName string, args amqp.Table) error
+	ExchangeDeclare(exchange string, kind string, args amqp.Table) error
+	QueueBind(queueName string, key string, exchange string) error
 	Publish(queueName string, msg amqp.Publishing) error
+	// PublishConfirm waits until the broker confirmed the message
+	PublishConfirm(ctx context.Context, queueName string, msg amqp.Publishing) error
 	Consume(queueName string, consumer string) (*amqp.Channel, <-chan amqp.Delivery, error)
+	// Status is nil while connected
+	Status() error
 }
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChatUniqueIDs deletes the copies of chat messages with the same twitch id and builds the unique index on it.
+func ChatUniqueIDs(gCtx global.Context) error {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).Aggregate(gCtx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$twitch.id",
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{
+			"count": bson.M{"$gt": 1},
+		}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(gCtx)
+
+	deleted := int64(0)
+	for cur.Next(gCtx) {
+		doc := struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}{}
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+
+		// the first copy is kept
+		res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).DeleteMany(gCtx, bson.M{
+			"_id": bson.M{"$in": doc.IDs[1:]},
+		})
+		if err != nil {
+			return err
+		}
+
+		deleted += res.DeletedCount
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	logrus.Infof("deleted %d copies of chat messages", deleted)
+
+	_, err = gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).Indexes().CreateOne(gCtx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "twitch.id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+)
+
+var migrations = map[string]func(gCtx global.Context) error{
+	"twitch-emotes-v2": TwitchEmotesV2,
+	"stream-key-hash":  StreamKeyHash,
+	"chat-unique-ids":  ChatUniqueIDs,
+}
+
+// Run runs a one-off migration by name.
+func Run(gCtx global.Context, name string) error {
+	migration, ok := migrations[name]
+	if !ok {
+		return fmt.Errorf("unknown migration: %s", name)
+	}
+
+	return migration(gCtx)
+}
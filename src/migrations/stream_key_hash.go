@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StreamKeyHash replaces the plaintext stream keys of users with a hash, the keys themselves keep working.
+func StreamKeyHash(gCtx global.Context) error {
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).Find(gCtx, bson.M{
+		"stream_key": bson.M{
+			"$type": "string",
+		},
+	}, options.Find().SetProjection(bson.M{
+		"stream_key": 1,
+	}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(gCtx)
+
+	now := time.Now()
+	models := []mongo.WriteModel{}
+	for cur.Next(gCtx) {
+		doc := struct {
+			ID        primitive.ObjectID `bson:"_id"`
+			StreamKey string             `bson:"stream_key"`
+		}{}
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+
+		update := bson.M{
+			"$unset": bson.M{
+				"stream_key": "",
+			},
+		}
+		if doc.StreamKey != "" {
+			prefix := doc.StreamKey
+			if len(prefix) > 8 {
+				prefix = prefix[:8]
+			}
+
+			update["$set"] = bson.M{
+				"hashed_stream_key": structures.UserStreamKey{
+					Hash:      structures.HashStreamKey(doc.StreamKey),
+					Prefix:    prefix,
+					CreatedAt: now,
+				},
+			}
+		}
+
+		models = append(models, &mongo.UpdateOneModel{
+			Filter: bson.M{
+				"_id": doc.ID,
+			},
+			Update: update,
+		})
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(gCtx, time.Minute)
+	defer cancel()
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return err
+	}
+
+	logrus.Infof("hashed the stream keys of %d users", len(models))
+
+	return nil
+}
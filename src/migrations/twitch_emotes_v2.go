@@ -0,0 +1,115 @@
+package migrations
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var legacyEmoteRegex = regexp.MustCompile(`^https://static-cdn\.jtvnw\.net/emoticons/v1/([^/]+)/`)
+
+// TwitchEmotesV2 rewrites the legacy emoticons/v1 urls of stored chat messages to the v2 cdn.
+func TwitchEmotesV2(gCtx global.Context) error {
+	formats := twitch.NewEmoteFormats(10000, time.Hour)
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).Find(gCtx, bson.M{
+		"chat_emote.urls": bson.M{
+			"$regex": "^https://static-cdn\\.jtvnw\\.net/emoticons/v1/",
+		},
+	}, options.Find().SetProjection(bson.M{
+		"chat_emote": 1,
+	}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(gCtx)
+
+	updated := 0
+	models := []mongo.WriteModel{}
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(gCtx, time.Minute)
+		defer cancel()
+
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+
+		updated += len(models)
+		logrus.Infof("migrated emotes on %d messages", updated)
+		models = []mongo.WriteModel{}
+
+		return nil
+	}
+
+	for cur.Next(gCtx) {
+		doc := struct {
+			ID     primitive.ObjectID     `bson:"_id"`
+			Emotes []structures.ChatEmote `bson:"chat_emote"`
+		}{}
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+
+		for i, e := range doc.Emotes {
+			if len(e.URLs) == 0 {
+				continue
+			}
+
+			match := legacyEmoteRegex.FindStringSubmatch(e.URLs[0])
+			if match == nil {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(gCtx, time.Second*5)
+			format, err := formats.Get(ctx, match[1])
+			cancel()
+
+			urlFormat := format
+			if err != nil {
+				// the default format serves whichever version the emote has
+				logrus.WithField("emote_id", match[1]).Warn("failed to get emote format: ", err)
+				urlFormat = twitch.EmoteFormatDefault
+			}
+
+			doc.Emotes[i].TwitchID = match[1]
+			doc.Emotes[i].URLs = twitch.EmoteURLs(match[1], urlFormat, twitch.EmoteThemeDark)
+			doc.Emotes[i].LightURLs = twitch.EmoteURLs(match[1], urlFormat, twitch.EmoteThemeLight)
+			doc.Emotes[i].Format = string(format)
+		}
+
+		models = append(models, &mongo.UpdateOneModel{
+			Filter: bson.M{
+				"_id": doc.ID,
+			},
+			Update: bson.M{
+				"$set": bson.M{
+					"chat_emote": doc.Emotes,
+				},
+			},
+		})
+
+		if len(models) >= 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
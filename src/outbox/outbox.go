@@ -0,0 +1,182 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	pollInterval = time.Second * 5
+	lease        = time.Second * 30
+	maxBackoff   = time.Minute
+)
+
+var wake = make(chan struct{}, 1)
+
+// Add writes messages to the outbox. With the context of a transaction they are only published once it commits.
+func Add(gCtx global.Context, ctx context.Context, msgs ...structures.OutboxMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	docs := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		msg.ID = primitive.NewObjectID()
+		msg.Status = structures.OutboxStatusPending
+		msg.CreatedAt = now
+		docs[i] = msg
+	}
+
+	_, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameOutbox).InsertMany(ctx, docs)
+
+	return err
+}
+
+// Notify wakes up the relay so committed messages do not wait for the next poll.
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// New relays the outbox to rmq until the context is done.
+func New(gCtx global.Context) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		backoff := time.Duration(0)
+		for {
+			wait := pollInterval
+			if err := relay(gCtx); err != nil {
+				backoff *= 2
+				if backoff < time.Second {
+					backoff = time.Second
+				} else if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+
+				wait = backoff
+				logrus.Errorf("failed to relay outbox, retrying in %s: %s", wait, err.Error())
+			} else {
+				backoff = 0
+			}
+
+			select {
+			case <-gCtx.Done():
+				return
+			case <-wake:
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	return done
+}
+
+// relay publishes pending messages, oldest first, until there are none left.
+func relay(gCtx global.Context) error {
+	for {
+		if gCtx.Err() != nil {
+			return nil
+		}
+
+		msg, err := claim(gCtx)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := publish(gCtx, msg); err != nil {
+			release(gCtx, msg, err)
+			return err
+		}
+	}
+}
+
+func claim(gCtx global.Context) (structures.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
+	defer cancel()
+
+	now := time.Now()
+	msg := structures.OutboxMessage{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameOutbox).FindOneAndUpdate(ctx, bson.M{
+		"status":       structures.OutboxStatusPending,
+		"locked_until": bson.M{"$lt": now},
+	}, bson.M{
+		"$set": bson.M{
+			"locked_until": now.Add(lease),
+		},
+	}, options.FindOneAndUpdate().SetSort(bson.M{"_id": 1}).SetReturnDocument(options.After))
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&msg)
+	}
+
+	return msg, err
+}
+
+func publish(gCtx global.Context, msg structures.OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
+	defer cancel()
+
+	if err := gCtx.Inst().RMQ.PublishConfirm(ctx, msg.Queue, amqp.Publishing{
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    msg.CreatedAt,
+		Expiration:   msg.Expiration,
+		Body:         msg.Body,
+	}); err != nil {
+		return err
+	}
+
+	// a failure here publishes the message again once the lease ran out
+	_, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameOutbox).UpdateOne(ctx, bson.M{
+		"_id": msg.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"status":  structures.OutboxStatusSent,
+			"sent_at": time.Now(),
+		},
+	})
+	if err != nil {
+		logrus.WithField("id", msg.ID.Hex()).Error("failed to mark outbox message sent: ", err)
+	}
+
+	return nil
+}
+
+// release records the failed attempt and hands the message to the next relay right away.
+func release(gCtx global.Context, msg structures.OutboxMessage, reason error) {
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
+	defer cancel()
+
+	if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameOutbox).UpdateOne(ctx, bson.M{
+		"_id": msg.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"error":        reason.Error(),
+			"locked_until": time.Time{},
+		},
+		"$inc": bson.M{
+			"attempts": 1,
+		},
+	}); err != nil {
+		logrus.WithField("id", msg.ID.Hex()).Error("failed to release outbox message: ", err)
+	}
+}
@@ -0,0 +1,39 @@
+package structures
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+)
+
+// Category is a twitch game as helix knows it.
+type Category struct {
+	ID   string `json:"id" bson:"_id"`
+	Name string `json:"name" bson:"name"`
+	// BoxArtURL is a template with {width} and {height} placeholders
+	BoxArtURL string `json:"box_art_url" bson:"box_art_url"`
+
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	CategoryUnknownID        = "0"
+	CategoryUnknownName      = "Unknown"
+	CategoryUnknownBoxArtURL = "https://static-cdn.jtvnw.net/ttv-static/404_boxart-{width}x{height}.jpg"
+)
+
+// BoxArt returns the box art url for a size.
+func (c Category) BoxArt(width int, height int) string {
+	return strings.NewReplacer("{width}", fmt.Sprint(width), "{height}", fmt.Sprint(height)).Replace(c.BoxArtURL)
+}
+
+func (c Category) ToModel() *model.Category {
+	return &model.Category{
+		ID:             c.ID,
+		Name:           c.Name,
+		BoxArtURL:      c.BoxArt(144, 192),
+		BoxArtTemplate: c.BoxArtURL,
+	}
+}
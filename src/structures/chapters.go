@@ -0,0 +1,118 @@
+package structures
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+)
+
+// VodChapter is a category of a vod with offsets from the start of the vod.
+type VodChapter struct {
+	Category VodCategory
+	Start    time.Duration
+	End      time.Duration
+	// Open is set on the last chapter of a live vod, End is the current length of the vod
+	Open bool
+}
+
+type VodChapters []VodChapter
+
+// Chapters turns the category timeline into chapters, a category starts a chapter that ends with the next one.
+func (v Vod) Chapters() VodChapters {
+	end := v.EndedAt
+	open := end.IsZero()
+	if open {
+		end = time.Now()
+	}
+
+	chapters := VodChapters{}
+	for i, c := range v.Categories {
+		if !c.Timestamp.Before(end) {
+			break
+		}
+
+		chapter := VodChapter{
+			Category: c,
+			Start:    c.Timestamp.Sub(v.StartedAt),
+			End:      end.Sub(v.StartedAt),
+			Open:     open,
+		}
+		if i+1 < len(v.Categories) && v.Categories[i+1].Timestamp.Before(end) {
+			chapter.End = v.Categories[i+1].Timestamp.Sub(v.StartedAt)
+			chapter.Open = false
+		}
+
+		// the first category is usually set a moment before the recording starts
+		if chapter.Start < 0 {
+			chapter.Start = 0
+		}
+		if chapter.End <= chapter.Start {
+			continue
+		}
+
+		chapters = append(chapters, chapter)
+	}
+
+	return chapters
+}
+
+func (c VodChapter) ToModel() *model.VodChapter {
+	m := &model.VodChapter{
+		Category:    c.Category.ToModel(),
+		StartOffset: c.Start.Seconds(),
+	}
+	if !c.Open {
+		end := c.End.Seconds()
+		duration := (c.End - c.Start).Seconds()
+		m.EndOffset = &end
+		m.Duration = &duration
+	}
+
+	return m
+}
+
+// WebVTT returns the chapters as a webvtt chapter track.
+func (c VodChapters) WebVTT() string {
+	sb := strings.Builder{}
+	sb.WriteString("WEBVTT\n")
+
+	for i, v := range c {
+		sb.WriteString(fmt.Sprintf("\n%d\n%s --> %s\n%s\n", i+1, vttTimestamp(v.Start), vttTimestamp(v.End), strings.ReplaceAll(v.Category.Name, "-->", "->")))
+	}
+
+	return sb.String()
+}
+
+// FFMetadata returns the chapters as an ffmpeg metadata file, which can be passed to ffmpeg with -map_metadata.
+func (c VodChapters) FFMetadata(title string) string {
+	sb := strings.Builder{}
+	sb.WriteString(";FFMETADATA1\n")
+	sb.WriteString("title=" + ffmetadataEscape(title) + "\n")
+
+	for _, v := range c {
+		sb.WriteString("\n[CHAPTER]\nTIMEBASE=1/1000\n")
+		sb.WriteString(fmt.Sprintf("START=%d\nEND=%d\n", v.Start.Milliseconds(), v.End.Milliseconds()))
+		sb.WriteString("title=" + ffmetadataEscape(v.Category.Name) + "\n")
+	}
+
+	return sb.String()
+}
+
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+var ffmetadataReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	"=", `\=`,
+	";", `\;`,
+	"#", `\#`,
+	"\n", "\\\n",
+)
+
+func ffmetadataEscape(s string) string {
+	return ffmetadataReplacer.Replace(s)
+}
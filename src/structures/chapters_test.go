@@ -0,0 +1,127 @@
+package structures
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVodChapters(t *testing.T) {
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	category := func(offset time.Duration, name string) VodCategory {
+		return VodCategory{Timestamp: start.Add(offset), Name: name, ID: name}
+	}
+
+	type chapter struct {
+		name  string
+		start time.Duration
+		end   time.Duration
+	}
+
+	tests := []struct {
+		name       string
+		categories []VodCategory
+		ended      time.Duration
+		want       []chapter
+	}{
+		{
+			name:       "categories end with the next one",
+			categories: []VodCategory{category(0, "a"), category(time.Hour, "b")},
+			ended:      time.Hour * 2,
+			want:       []chapter{{"a", 0, time.Hour}, {"b", time.Hour, time.Hour * 2}},
+		},
+		{
+			name:       "a category set before the start starts at zero",
+			categories: []VodCategory{category(-time.Minute, "a"), category(time.Hour, "b")},
+			ended:      time.Hour * 2,
+			want:       []chapter{{"a", 0, time.Hour}, {"b", time.Hour, time.Hour * 2}},
+		},
+		{
+			name:       "categories set before the start are dropped when another one follows",
+			categories: []VodCategory{category(-time.Hour, "a"), category(-time.Minute, "b"), category(time.Hour, "c")},
+			ended:      time.Hour * 2,
+			want:       []chapter{{"b", 0, time.Hour}, {"c", time.Hour, time.Hour * 2}},
+		},
+		{
+			name:       "categories after the end are dropped",
+			categories: []VodCategory{category(0, "a"), category(time.Hour*3, "b")},
+			ended:      time.Hour * 2,
+			want:       []chapter{{"a", 0, time.Hour * 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vod := Vod{StartedAt: start, EndedAt: start.Add(tt.ended), Categories: tt.categories}
+
+			got := vod.Chapters()
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d chapters, got %d: %+v", len(tt.want), len(got), got)
+			}
+
+			for i, want := range tt.want {
+				c := got[i]
+				if c.Category.Name != want.name || c.Open {
+					t.Fatalf("chapter %d: got %+v, want %+v", i, c, want)
+				}
+				if c.Start != want.start || c.End != want.end {
+					t.Fatalf("chapter %d: got %s - %s, want %s - %s", i, c.Start, c.End, want.start, want.end)
+				}
+			}
+		})
+	}
+}
+
+func TestVodChaptersLive(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	vod := Vod{StartedAt: start, Categories: []VodCategory{
+		{Timestamp: start, Name: "a"},
+		{Timestamp: start.Add(time.Minute * 30), Name: "b"},
+	}}
+
+	got := vod.Chapters()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 chapters, got %+v", got)
+	}
+	if got[0].Open || got[0].End != time.Minute*30 {
+		t.Fatalf("expected the first chapter to end with the second, got %+v", got[0])
+	}
+	if !got[1].Open || got[1].End < time.Minute*30 {
+		t.Fatalf("expected the last chapter to be open until now, got %+v", got[1])
+	}
+	if m := got[1].ToModel(); m.EndOffset != nil || m.Duration != nil {
+		t.Fatalf("expected an open chapter without an end, got %+v", m)
+	}
+}
+
+func TestVodChaptersWebVTT(t *testing.T) {
+	chapters := VodChapters{
+		{Category: VodCategory{Name: "Just Chatting"}, Start: 0, End: time.Minute + time.Millisecond*500},
+		{Category: VodCategory{Name: "a --> b"}, Start: time.Minute + time.Millisecond*500, End: time.Hour*26 + time.Second},
+	}
+
+	want := "WEBVTT\n" +
+		"\n1\n00:00:00.000 --> 00:01:00.500\nJust Chatting\n" +
+		"\n2\n00:01:00.500 --> 26:00:01.000\na -> b\n"
+	if got := chapters.WebVTT(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got := (VodChapters{}).WebVTT(); got != "WEBVTT\n" {
+		t.Fatalf("got %q for no chapters", got)
+	}
+}
+
+func TestVodChaptersFFMetadata(t *testing.T) {
+	chapters := VodChapters{
+		{Category: VodCategory{Name: "Just Chatting"}, Start: 0, End: time.Minute},
+		{Category: VodCategory{Name: "a=b;c#d\\e"}, Start: time.Minute, End: time.Minute * 2},
+	}
+
+	want := ";FFMETADATA1\n" +
+		"title=title\\\nline\n" +
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=60000\ntitle=Just Chatting\n" +
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=60000\nEND=120000\n" + `title=a\=b\;c\#d\\e` + "\n"
+	if got := chapters.FFMetadata("title\nline"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -11,6 +11,8 @@ type Chat struct {
 	ID    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	VodID primitive.ObjectID `json:"vod_id" bson:"vod_id"`
 
+	Type ChatType `json:"type" bson:"type"`
+
 	Twitch ChatTwitch `json:"twitch" bson:"twitch"`
 
 	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
@@ -19,6 +21,18 @@ type Chat struct {
 
 	Badges []ChatBadge `json:"badges" bson:"badges"`
 	Emotes []ChatEmote `json:"emotes" bson:"chat_emote"`
+
+	UserNotice *ChatUserNotice `json:"user_notice,omitempty" bson:"user_notice,omitempty"`
+
+	Deleted *ChatDeleted `json:"deleted,omitempty" bson:"deleted,omitempty"`
+}
+
+func (c Chat) ToEvent() model.ChatEvent {
+	if c.Type == ChatTypeUserNotice && c.UserNotice != nil {
+		return c.ToUserNoticeModel()
+	}
+
+	return c.ToModel()
 }
 
 func (c Chat) ToModel() *model.Chat {
@@ -32,6 +46,11 @@ func (c Chat) ToModel() *model.Chat {
 		emotes[i] = v.ToModel()
 	}
 
+	var deleted *model.ChatDeleted
+	if c.Deleted != nil {
+		deleted = c.Deleted.ToModel()
+	}
+
 	return &model.Chat{
 		ID:        c.ID,
 		VodID:     c.VodID,
@@ -40,7 +59,192 @@ func (c Chat) ToModel() *model.Chat {
 		Content:   c.Content,
 		Badges:    badges,
 		Emotes:    emotes,
+		Deleted:   deleted,
+	}
+}
+
+func (c Chat) ToUserNoticeModel() *model.ChatUserNotice {
+	badges := make([]*model.ChatBadge, len(c.Badges))
+	for i, v := range c.Badges {
+		badges[i] = v.ToModel()
+	}
+
+	emotes := make([]*model.ChatEmote, len(c.Emotes))
+	for i, v := range c.Emotes {
+		emotes[i] = v.ToModel()
+	}
+
+	notice := ChatUserNotice{}
+	if c.UserNotice != nil {
+		notice = *c.UserNotice
+	}
+
+	var recipient *model.ChatUserNoticeRecipient
+	if notice.Recipient != nil {
+		recipient = notice.Recipient.ToModel()
+	}
+
+	var deleted *model.ChatDeleted
+	if c.Deleted != nil {
+		deleted = c.Deleted.ToModel()
+	}
+
+	return &model.ChatUserNotice{
+		ID:               c.ID,
+		VodID:            c.VodID,
+		Twitch:           c.Twitch.ToModel(),
+		Timestamp:        c.Timestamp,
+		Kind:             notice.Kind.ToModel(),
+		MsgID:            notice.MsgID,
+		SystemMessage:    notice.SystemMessage,
+		Content:          c.Content,
+		Badges:           badges,
+		Emotes:           emotes,
+		CumulativeMonths: notice.CumulativeMonths,
+		StreakMonths:     notice.StreakMonths,
+		SubPlan:          notice.SubPlan,
+		GiftCount:        notice.GiftCount,
+		SenderGiftCount:  notice.SenderGiftCount,
+		GiftMonths:       notice.GiftMonths,
+		Recipient:        recipient,
+		RaidViewerCount:  notice.RaidViewerCount,
+		Deleted:          deleted,
+	}
+}
+
+type ChatDeleted struct {
+	Reason    ChatDeletedReason `json:"reason" bson:"reason"`
+	Duration  int               `json:"duration,omitempty" bson:"duration,omitempty"`
+	Timestamp time.Time         `json:"timestamp" bson:"timestamp"`
+}
+
+func (c ChatDeleted) ToModel() *model.ChatDeleted {
+	var duration *int
+	if c.Reason == ChatDeletedReasonTimeout {
+		duration = &c.Duration
+	}
+
+	return &model.ChatDeleted{
+		Reason:    c.Reason.ToModel(),
+		Duration:  duration,
+		Timestamp: c.Timestamp,
+	}
+}
+
+type ChatDeletedReason int32
+
+const (
+	ChatDeletedReasonBan ChatDeletedReason = iota
+	ChatDeletedReasonTimeout
+	ChatDeletedReasonDelete
+	ChatDeletedReasonClear
+)
+
+func (c ChatDeletedReason) ToModel() model.ChatDeletedReason {
+	switch c {
+	case ChatDeletedReasonBan:
+		return model.ChatDeletedReasonBan
+	case ChatDeletedReasonTimeout:
+		return model.ChatDeletedReasonTimeout
+	case ChatDeletedReasonDelete:
+		return model.ChatDeletedReasonDelete
+	case ChatDeletedReasonClear:
+		return model.ChatDeletedReasonClear
 	}
+
+	return model.ChatDeletedReasonUnknown
+}
+
+type ChatType int32
+
+const (
+	ChatTypeMessage ChatType = iota
+	ChatTypeUserNotice
+)
+
+type ChatUserNotice struct {
+	Kind          ChatUserNoticeKind `json:"kind" bson:"kind"`
+	MsgID         string             `json:"msg_id" bson:"msg_id"`
+	SystemMessage string             `json:"system_message" bson:"system_message"`
+
+	CumulativeMonths int    `json:"cumulative_months" bson:"cumulative_months"`
+	StreakMonths     int    `json:"streak_months" bson:"streak_months"`
+	SubPlan          string `json:"sub_plan" bson:"sub_plan"`
+	// GiftCount is the number of subs gifted with the notice
+	GiftCount int `json:"gift_count" bson:"gift_count"`
+	// SenderGiftCount is the number of subs the gifter gifted in the channel so far, twitch leaves it out for anonymous gifts
+	SenderGiftCount int `json:"sender_gift_count" bson:"sender_gift_count"`
+	// GiftMonths is the number of months a gifted sub lasts
+	GiftMonths int `json:"gift_months" bson:"gift_months"`
+
+	Recipient *ChatUserNoticeRecipient `json:"recipient,omitempty" bson:"recipient,omitempty"`
+
+	RaidViewerCount int `json:"raid_viewer_count" bson:"raid_viewer_count"`
+}
+
+type ChatUserNoticeRecipient struct {
+	UserID      string `json:"user_id" bson:"user_id"`
+	Login       string `json:"login" bson:"login"`
+	DisplayName string `json:"display_name" bson:"display_name"`
+}
+
+func (c ChatUserNoticeRecipient) ToModel() *model.ChatUserNoticeRecipient {
+	return &model.ChatUserNoticeRecipient{
+		UserID:      c.UserID,
+		Login:       c.Login,
+		DisplayName: c.DisplayName,
+	}
+}
+
+type ChatUserNoticeKind int32
+
+const (
+	ChatUserNoticeKindOther ChatUserNoticeKind = iota
+	ChatUserNoticeKindSub
+	ChatUserNoticeKindResub
+	ChatUserNoticeKindSubGift
+	ChatUserNoticeKindSubMysteryGift
+	ChatUserNoticeKindRaid
+	ChatUserNoticeKindAnnouncement
+)
+
+// ChatUserNoticeKindFromMsgID maps the msg-id tag of a USERNOTICE to the kind we store.
+func ChatUserNoticeKindFromMsgID(msgID string) ChatUserNoticeKind {
+	switch msgID {
+	case "sub":
+		return ChatUserNoticeKindSub
+	case "resub":
+		return ChatUserNoticeKindResub
+	case "subgift", "anonsubgift":
+		return ChatUserNoticeKindSubGift
+	case "submysterygift", "anonsubmysterygift":
+		return ChatUserNoticeKindSubMysteryGift
+	case "raid":
+		return ChatUserNoticeKindRaid
+	case "announcement":
+		return ChatUserNoticeKindAnnouncement
+	}
+
+	return ChatUserNoticeKindOther
+}
+
+func (c ChatUserNoticeKind) ToModel() model.ChatUserNoticeKind {
+	switch c {
+	case ChatUserNoticeKindSub:
+		return model.ChatUserNoticeKindSub
+	case ChatUserNoticeKindResub:
+		return model.ChatUserNoticeKindResub
+	case ChatUserNoticeKindSubGift:
+		return model.ChatUserNoticeKindSubGift
+	case ChatUserNoticeKindSubMysteryGift:
+		return model.ChatUserNoticeKindSubMysteryGift
+	case ChatUserNoticeKindRaid:
+		return model.ChatUserNoticeKindRaid
+	case ChatUserNoticeKindAnnouncement:
+		return model.ChatUserNoticeKindAnnouncement
+	}
+
+	return model.ChatUserNoticeKindOther
 }
 
 type ChatTwitch struct {
@@ -62,27 +266,55 @@ func (c ChatTwitch) ToModel() *model.ChatTwitch {
 }
 
 type ChatBadge struct {
-	Name string   `json:"name" bson:"name"`
-	URLs []string `json:"urls" bson:"urls"`
+	// Name is the title of the badge version
+	Name string `json:"name" bson:"name"`
+	// SetID is the badge set, such as subscriber or moderator
+	SetID   string   `json:"set_id,omitempty" bson:"set_id,omitempty"`
+	Version string   `json:"version,omitempty" bson:"version,omitempty"`
+	URLs    []string `json:"urls" bson:"urls"`
+
+	// LegacyTitle is set on messages that were stored with the set id as the name
+	LegacyTitle string `json:"-" bson:"title,omitempty"`
 }
 
 func (c ChatBadge) ToModel() *model.ChatBadge {
+	name, setID := c.Name, c.SetID
+	if c.LegacyTitle != "" {
+		name, setID = c.LegacyTitle, c.Name
+	}
+
 	return &model.ChatBadge{
-		Name: c.Name,
-		Urls: c.URLs,
+		Name:    name,
+		SetID:   setID,
+		Version: c.Version,
+		Urls:    c.URLs,
 	}
 }
 
 type ChatEmote struct {
-	Name      string   `json:"name" bson:"name"`
+	Name string `json:"name" bson:"name"`
+	// TwitchID is only set for twitch emotes
+	TwitchID  string   `json:"twitch_id,omitempty" bson:"twitch_id,omitempty"`
 	ZeroWidth bool     `json:"zero_width" bson:"zero_width"`
 	URLs      []string `json:"urls" bson:"urls"`
+	// LightURLs are only set for emotes which have a version for light themes
+	LightURLs []string `json:"light_urls,omitempty" bson:"light_urls,omitempty"`
+	// Format is either static or animated, it is empty when the provider does not tell us
+	Format string `json:"format,omitempty" bson:"format,omitempty"`
 }
 
 func (c ChatEmote) ToModel() *model.ChatEmote {
+	lightURLs := c.LightURLs
+	if len(lightURLs) == 0 {
+		lightURLs = c.URLs
+	}
+
 	return &model.ChatEmote{
 		Name:      c.Name,
 		ZeroWidth: c.ZeroWidth,
 		Urls:      c.URLs,
+		LightUrls: lightURLs,
+		Format:    c.Format,
+		Animated:  c.Format == "animated",
 	}
 }
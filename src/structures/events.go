@@ -0,0 +1,54 @@
+package structures
+
+import (
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VodEvent records a state change of a vod.
+type VodEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VodID     primitive.ObjectID `json:"vod_id" bson:"vod_id"`
+	From      VodState           `json:"from" bson:"from"`
+	To        VodState           `json:"to" bson:"to"`
+	Actor     VodEventActor      `json:"actor" bson:"actor"`
+	Reason    string             `json:"reason" bson:"reason"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+}
+
+func (v VodEvent) ToModel() *model.VodEvent {
+	return &model.VodEvent{
+		From:      v.From.ToModel(),
+		To:        v.To.ToModel(),
+		Actor:     v.Actor.ToModel(),
+		Reason:    v.Reason,
+		Timestamp: v.Timestamp,
+	}
+}
+
+type VodEventActorType string
+
+const (
+	// VodEventActorSystem is the api itself, like the end of a publish or an update of the transcoder
+	VodEventActorSystem VodEventActorType = "system"
+	VodEventActorUser   VodEventActorType = "user"
+	VodEventActorAdmin  VodEventActorType = "admin"
+)
+
+type VodEventActor struct {
+	Type   VodEventActorType  `json:"type" bson:"type"`
+	UserID primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+}
+
+func (v VodEventActor) ToModel() *model.VodEventActor {
+	m := &model.VodEventActor{
+		Type: string(v.Type),
+	}
+	if !v.UserID.IsZero() {
+		m.UserID = &v.UserID
+	}
+
+	return m
+}
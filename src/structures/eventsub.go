@@ -0,0 +1,47 @@
+package structures
+
+import (
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/graph/model"
+)
+
+// EventSubSubscription is the last known state of an eventsub subscription, there is one per type and broadcaster.
+type EventSubSubscription struct {
+	Type              string `json:"type" bson:"type"`
+	BroadcasterUserID string `json:"broadcaster_user_id" bson:"broadcaster_user_id"`
+
+	TwitchID  string `json:"twitch_id" bson:"twitch_id"`
+	Status    string `json:"status" bson:"status"`
+	Transport string `json:"transport" bson:"transport"`
+
+	// RevokedReason is the status twitch sent with the last revocation
+	RevokedReason string    `json:"revoked_reason,omitempty" bson:"revoked_reason,omitempty"`
+	RevokedAt     time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	Revocations   int       `json:"revocations" bson:"revocations"`
+
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+func (e EventSubSubscription) ToModel() *model.EventSubSubscription {
+	var revokedAt *time.Time
+	if !e.RevokedAt.IsZero() {
+		revokedAt = &e.RevokedAt
+	}
+	var revokedReason *string
+	if e.RevokedReason != "" {
+		revokedReason = &e.RevokedReason
+	}
+
+	return &model.EventSubSubscription{
+		Type:              e.Type,
+		BroadcasterUserID: e.BroadcasterUserID,
+		TwitchID:          e.TwitchID,
+		Status:            e.Status,
+		Transport:         e.Transport,
+		RevokedReason:     revokedReason,
+		RevokedAt:         revokedAt,
+		Revocations:       e.Revocations,
+		UpdatedAt:         e.UpdatedAt,
+	}
+}
@@ -0,0 +1,33 @@
+package structures
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "pending"
+	OutboxStatusSent    OutboxStatus = "sent"
+)
+
+// OutboxMessage is a rmq message that is written together with the change it belongs to and published after.
+type OutboxMessage struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Queue       string             `json:"queue" bson:"queue"`
+	ContentType string             `json:"content_type" bson:"content_type"`
+	Body        []byte             `json:"body" bson:"body"`
+	// Expiration is how many milliseconds the message stays in the queue before it is dead lettered
+	Expiration string `json:"expiration,omitempty" bson:"expiration,omitempty"`
+
+	Status OutboxStatus `json:"status" bson:"status"`
+	// Attempts and Error are the failed attempts at publishing the message
+	Attempts int    `json:"attempts" bson:"attempts"`
+	Error    string `json:"error,omitempty" bson:"error,omitempty"`
+	// LockedUntil keeps other relays away while one publishes the message
+	LockedUntil time.Time  `json:"locked_until" bson:"locked_until"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	SentAt      *time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+}
@@ -5,10 +5,14 @@ import "go.mongodb.org/mongo-driver/bson/primitive"
 type VodTranscodeJob struct {
 	VodID   primitive.ObjectID `json:"vod_id"`
 	Variant VodVariant         `json:"variant"`
+	// Attempt starts at 1 and goes up with every retry
+	Attempt int `json:"attempt"`
 }
 
 type ApiTranscodeUpdate struct {
 	VodID   primitive.ObjectID `json:"vod_id"`
 	Variant VodVariant         `json:"variant"`
 	Error   string             `json:"error"`
+	// Attempt is the attempt of the job the update is for
+	Attempt int `json:"attempt"`
 }
@@ -0,0 +1,24 @@
+package structures
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stream is a twitch broadcast as reported by eventsub, it may exist without a vod.
+type Stream struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	VodID  primitive.ObjectID `json:"vod_id,omitempty" bson:"vod_id,omitempty"`
+
+	Twitch StreamTwitch `json:"twitch" bson:"twitch"`
+
+	StartedAt time.Time `json:"started_at" bson:"started_at"`
+	EndedAt   time.Time `json:"ended_at" bson:"ended_at"`
+}
+
+type StreamTwitch struct {
+	ID   string `json:"id" bson:"id"`
+	Type string `json:"type" bson:"type"`
+}
@@ -1,6 +1,10 @@
 package structures
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
 	"github.com/AdmiralBulldogTv/VodApi/graph/model"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -10,13 +14,91 @@ type User struct {
 
 	Twitch UserTwitch `json:"twitch" bson:"twitch"`
 
-	StreamKey string `json:"stream_key" bson:"stream_key"`
+	StreamKey UserStreamKey `json:"stream_key" bson:"hashed_stream_key"`
+
+	Settings UserSettings `json:"settings" bson:"settings"`
 }
 
 func (u User) ToModel() *model.User {
 	return &model.User{
-		ID:     u.ID,
-		Twitch: u.Twitch.ToModel(),
+		ID:       u.ID,
+		Twitch:   u.Twitch.ToModel(),
+		Settings: u.Settings.ToModel(),
+	}
+}
+
+type UserSettings struct {
+	Emotes    UserEmoteSettings     `json:"emotes" bson:"emotes"`
+	Transcode UserTranscodeSettings `json:"transcode" bson:"transcode"`
+}
+
+func (u UserSettings) ToModel() *model.UserSettings {
+	return &model.UserSettings{
+		Emotes:    u.Emotes.ToModel(),
+		Transcode: u.Transcode.ToModel(),
+	}
+}
+
+type UserTranscodeSettings struct {
+	// Ladder holds the names of the variants the vods of the user are transcoded to,
+	// the configured default ladder is used when it is empty.
+	Ladder []string `json:"ladder" bson:"ladder"`
+}
+
+func (u UserTranscodeSettings) ToModel() *model.UserTranscodeSettings {
+	ladder := u.Ladder
+	if ladder == nil {
+		ladder = []string{}
+	}
+
+	return &model.UserTranscodeSettings{
+		Ladder: ladder,
+	}
+}
+
+type UserEmoteSettings struct {
+	// Providers are ordered by precedence, earlier providers win when emote names collide.
+	// When no providers are configured every provider is enabled in the default order.
+	Providers []UserEmoteProvider `json:"providers" bson:"providers"`
+}
+
+func (u UserEmoteSettings) ToModel() *model.UserEmoteSettings {
+	providers := make([]*model.UserEmoteProvider, len(u.Providers))
+	for i, v := range u.Providers {
+		providers[i] = v.ToModel()
+	}
+
+	return &model.UserEmoteSettings{
+		Providers: providers,
+	}
+}
+
+// EnabledProviders returns the names of the enabled providers in order of precedence,
+// or nil when the user has not configured any providers.
+func (u UserEmoteSettings) EnabledProviders() []string {
+	if len(u.Providers) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	for _, v := range u.Providers {
+		if v.Enabled {
+			names = append(names, v.Name)
+		}
+	}
+
+	return names
+}
+
+type UserEmoteProvider struct {
+	Name    string `json:"name" bson:"name"`
+	Enabled bool   `json:"enabled" bson:"enabled"`
+}
+
+func (u UserEmoteProvider) ToModel() *model.UserEmoteProvider {
+	return &model.UserEmoteProvider{
+		Name:    u.Name,
+		Enabled: u.Enabled,
 	}
 }
 
@@ -35,3 +117,48 @@ func (u UserTwitch) ToModel() *model.UserTwitch {
 		ProfilePicture: u.ProfilePicture,
 	}
 }
+
+// UserStreamKey only keeps a hash of the stream key, the key itself is shown once when it is rotated.
+type UserStreamKey struct {
+	Hash      string    `json:"-" bson:"hash"`
+	Prefix    string    `json:"prefix" bson:"prefix"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	RevokedAt time.Time `json:"revoked_at" bson:"revoked_at"`
+}
+
+func (u UserStreamKey) ToModel() *model.StreamKey {
+	m := &model.StreamKey{
+		Prefix: u.Prefix,
+		Active: u.Hash != "",
+	}
+	if !u.CreatedAt.IsZero() {
+		m.CreatedAt = &u.CreatedAt
+	}
+	if !u.RevokedAt.IsZero() {
+		m.RevokedAt = &u.RevokedAt
+	}
+
+	return m
+}
+
+// HashStreamKey returns the hash a stream key is stored and looked up by.
+func HashStreamKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+type StreamKeyAction string
+
+const (
+	StreamKeyActionRotate StreamKeyAction = "rotate"
+	StreamKeyActionRevoke StreamKeyAction = "revoke"
+)
+
+// StreamKeyAudit records every rotation and revocation of a stream key.
+type StreamKeyAudit struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Action    StreamKeyAction    `json:"action" bson:"action"`
+	Prefix    string             `json:"prefix" bson:"prefix"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+}
@@ -13,12 +13,19 @@ type Vod struct {
 
 	Title string `json:"title" bson:"title"`
 
+	TwitchStreamID string `json:"twitch_stream_id,omitempty" bson:"twitch_stream_id,omitempty"`
+
+	Titles     []VodTitle    `json:"titles" bson:"titles"`
 	Categories []VodCategory `json:"categories" bson:"categories"`
 
 	State      VodState      `json:"vod_state" bson:"vod_state"`
 	Visibility VodVisibility `json:"vod_visibility" bson:"vod_visibility"`
 
 	Variants []VodVariant `json:"variants" bson:"variants"`
+	// TranscodeErrors holds every error the transcoder reported, including the ones that were retried
+	TranscodeErrors []VodTranscodeError `json:"transcode_errors" bson:"transcode_errors"`
+	// Source is reported by the transcoder with the source variant, it is empty until then
+	Source VodSource `json:"source" bson:"source"`
 
 	Thumbnail struct {
 		Static   string `json:"static" bson:"static"`
@@ -30,10 +37,23 @@ type Vod struct {
 }
 
 func (v Vod) ToModel() *model.Vod {
+	titles := make([]*model.VodTitle, len(v.Titles))
+	for i, v := range v.Titles {
+		titles[i] = v.ToModel()
+	}
+	dbChapters := v.Chapters()
+	chapters := make([]*model.VodChapter, len(dbChapters))
+	for i, v := range dbChapters {
+		chapters[i] = v.ToModel()
+	}
 	categories := make([]*model.VodCategory, len(v.Categories))
 	for i, v := range v.Categories {
 		categories[i] = v.ToModel()
 	}
+	transcodeErrors := make([]*model.VodTranscodeError, len(v.TranscodeErrors))
+	for i, v := range v.TranscodeErrors {
+		transcodeErrors[i] = v.ToModel()
+	}
 	variants := make([]*model.VodVariant, len(v.Variants))
 	for i, v := range v.Variants {
 		variants[i] = v.ToModel()
@@ -43,11 +63,14 @@ func (v Vod) ToModel() *model.Vod {
 		endedAt = &v.EndedAt
 	}
 	return &model.Vod{
-		ID:         v.ID,
-		UserID:     v.UserID,
-		Title:      v.Title,
-		Categories: categories,
-		Variants:   variants,
+		ID:              v.ID,
+		UserID:          v.UserID,
+		Title:           v.Title,
+		Titles:          titles,
+		Categories:      categories,
+		Chapters:        chapters,
+		Variants:        variants,
+		TranscodeErrors: transcodeErrors,
 		Thumbnails: &model.VodThumbnails{
 			Static:   v.Thumbnail.Static,
 			Animated: v.Thumbnail.Animated,
@@ -59,6 +82,22 @@ func (v Vod) ToModel() *model.Vod {
 	}
 }
 
+type VodTitle struct {
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+	Title     string    `json:"title" bson:"title"`
+	Language  string    `json:"language" bson:"language"`
+	IsMature  bool      `json:"is_mature" bson:"is_mature"`
+}
+
+func (v VodTitle) ToModel() *model.VodTitle {
+	return &model.VodTitle{
+		Timestamp: v.Timestamp,
+		Title:     v.Title,
+		Language:  v.Language,
+		IsMature:  v.IsMature,
+	}
+}
+
 type VodCategory struct {
 	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
 	Name      string    `json:"name" bson:"name"`
@@ -126,22 +165,73 @@ func (v VodVisibility) ToModel() model.VodVisibility {
 	return "unknown"
 }
 
+type VodSource struct {
+	Width  int `json:"width" bson:"width"`
+	Height int `json:"height" bson:"height"`
+	FPS    int `json:"fps" bson:"fps"`
+	// Bitrate is in bits per second
+	Bitrate int `json:"bitrate" bson:"bitrate"`
+}
+
 type VodVariant struct {
-	Name    string `json:"name" bson:"name"`
-	Width   int    `json:"width" bson:"width"`
-	Height  int    `json:"height" bson:"height"`
-	FPS     int    `json:"fps" bson:"fps"`
-	Bitrate int    `json:"bitrate" bson:"bitrate"`
-	Ready   bool   `json:"ready" bson:"ready"`
+	Name      string `json:"name" bson:"name"`
+	Width     int    `json:"width" bson:"width"`
+	Height    int    `json:"height" bson:"height"`
+	FPS       int    `json:"fps" bson:"fps"`
+	Bitrate   int    `json:"bitrate" bson:"bitrate"`
+	AudioOnly bool   `json:"audio_only" bson:"audio_only"`
+	Ready     bool   `json:"ready" bson:"ready"`
+	// Error is set once the variant failed and will not be retried anymore
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// Attempts counts the failed attempts at transcoding the variant, it keeps counting across requeues
+	Attempts int `json:"attempts" bson:"attempts"`
+	// RetryBase is the number of attempts when the variant was last requeued, the retries of a run are counted from it
+	RetryBase int `json:"retry_base" bson:"retry_base"`
 }
 
 func (v VodVariant) ToModel() *model.VodVariant {
+	var err *string
+	if v.Error != "" {
+		err = &v.Error
+	}
+
 	return &model.VodVariant{
-		Name:    v.Name,
-		Width:   v.Width,
-		Height:  v.Height,
-		Fps:     v.FPS,
-		Bitrate: v.Bitrate,
-		Ready:   v.Ready,
+		Name:      v.Name,
+		Width:     v.Width,
+		Height:    v.Height,
+		Fps:       v.FPS,
+		Bitrate:   v.Bitrate,
+		AudioOnly: v.AudioOnly,
+		Ready:     v.Ready,
+		Error:     err,
+		Attempts:  v.Attempts,
+	}
+}
+
+// ToTranscodeModel returns the variant as a rung of a transcode ladder.
+func (v VodVariant) ToTranscodeModel() *model.TranscodeVariant {
+	return &model.TranscodeVariant{
+		Name:      v.Name,
+		Width:     v.Width,
+		Height:    v.Height,
+		Fps:       v.FPS,
+		Bitrate:   v.Bitrate,
+		AudioOnly: v.AudioOnly,
+	}
+}
+
+type VodTranscodeError struct {
+	Variant   string    `json:"variant" bson:"variant"`
+	Attempt   int       `json:"attempt" bson:"attempt"`
+	Error     string    `json:"error" bson:"error"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+}
+
+func (v VodTranscodeError) ToModel() *model.VodTranscodeError {
+	return &model.VodTranscodeError{
+		Variant:   v.Variant,
+		Attempt:   v.Attempt,
+		Error:     v.Error,
+		Timestamp: v.Timestamp,
 	}
 }
@@ -6,4 +6,10 @@ const (
 	CollectionNameUsers instance.MongoCollectionName = "users"
 	CollectionNameVods  instance.MongoCollectionName = "vods"
 	CollectionNameChat  instance.MongoCollectionName = "chat"
+
+	CollectionNameEventSubs      instance.MongoCollectionName = "eventsub_subscriptions"
+	CollectionNameCategories     instance.MongoCollectionName = "categories"
+	CollectionNameStreamKeyAudit instance.MongoCollectionName = "stream_key_audit"
+	CollectionNameVodEvents      instance.MongoCollectionName = "vod_events"
+	CollectionNameOutbox         instance.MongoCollectionName = "outbox"
 )
@@ -40,6 +40,18 @@ func New(ctx context.Context, opt SetupOptions) (instance.Mongo, error) {
 	}, nil
 }
 
+// Transaction runs fn in a transaction, which needs a replica set.
+// Operations only belong to the transaction when they use the context passed to fn, which may be called again on transient errors.
+func Transaction(ctx context.Context, inst instance.Mongo, fn func(ctx context.Context) error) error {
+	return inst.RawClient().UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+
+		return err
+	})
+}
+
 type SetupOptions struct {
 	URI      string
 	Database string
@@ -52,10 +64,14 @@ type IndexRef struct {
 	Index      mongo.IndexModel
 }
 
+type BulkWriteException = mongo.BulkWriteException
+
 var (
 	ErrNoDocuments = mongo.ErrNoDocuments
 )
 
+const ErrCodeDuplicateKey = 11000
+
 const (
 	CollectionUsers   instance.MongoCollectionName = "users"
 	CollectionStreams instance.MongoCollectionName = "streams"
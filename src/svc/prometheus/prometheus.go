@@ -10,12 +10,29 @@ import (
 type mon struct {
 	responseTimeMilliseconds prometheus.Histogram
 	twitchChatMessages       prometheus.Histogram
+
+	twitchChatQueueLength               prometheus.Gauge
+	twitchChatDroppedMessages           prometheus.Counter
+	twitchChatFlushDurationMilliseconds prometheus.Histogram
+	twitchChatFlushSize                 prometheus.Histogram
+
+	twitchEventSubSubscriptions *prometheus.GaugeVec
+
+	rmqConnected  prometheus.Gauge
+	rmqReconnects prometheus.Counter
 }
 
 func (m *mon) Register(r prometheus.Registerer) {
 	r.MustRegister(
 		m.responseTimeMilliseconds,
 		m.twitchChatMessages,
+		m.twitchChatQueueLength,
+		m.twitchChatDroppedMessages,
+		m.twitchChatFlushDurationMilliseconds,
+		m.twitchChatFlushSize,
+		m.twitchEventSubSubscriptions,
+		m.rmqConnected,
+		m.rmqReconnects,
 	)
 }
 
@@ -27,6 +44,34 @@ func (m *mon) TwitchChatMessages() prometheus.Histogram {
 	return m.twitchChatMessages
 }
 
+func (m *mon) TwitchChatQueueLength() prometheus.Gauge {
+	return m.twitchChatQueueLength
+}
+
+func (m *mon) TwitchChatDroppedMessages() prometheus.Counter {
+	return m.twitchChatDroppedMessages
+}
+
+func (m *mon) TwitchChatFlushDurationMilliseconds() prometheus.Histogram {
+	return m.twitchChatFlushDurationMilliseconds
+}
+
+func (m *mon) TwitchChatFlushSize() prometheus.Histogram {
+	return m.twitchChatFlushSize
+}
+
+func (m *mon) TwitchEventSubSubscriptions() *prometheus.GaugeVec {
+	return m.twitchEventSubSubscriptions
+}
+
+func (m *mon) RMQConnected() prometheus.Gauge {
+	return m.rmqConnected
+}
+
+func (m *mon) RMQReconnects() prometheus.Counter {
+	return m.rmqReconnects
+}
+
 func LabelsFromKeyValue(kv []configure.KeyValue) prometheus.Labels {
 	mp := prometheus.Labels{}
 
@@ -47,6 +92,35 @@ func New(opts SetupOptions) instance.Prometheus {
 			Name: "api_twitch_chat_messages",
 			Help: "The number of messages read",
 		}),
+		twitchChatQueueLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "api_twitch_chat_queue_length",
+			Help: "The number of messages waiting to be written",
+		}),
+		twitchChatDroppedMessages: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "api_twitch_chat_dropped_messages",
+			Help: "The number of messages dropped because the write queue was full",
+		}),
+		twitchChatFlushDurationMilliseconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "api_twitch_chat_flush_duration_milliseconds",
+			Help: "The time it takes to write a batch of messages in milliseconds",
+		}),
+		twitchChatFlushSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "api_twitch_chat_flush_size",
+			Help:    "The number of messages written in a batch",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		}),
+		twitchEventSubSubscriptions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "api_twitch_eventsub_subscriptions",
+			Help: "The number of eventsub subscriptions by type and status",
+		}, []string{"type", "status"}),
+		rmqConnected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "api_rmq_connected",
+			Help: "Whether the rmq connection is up",
+		}),
+		rmqReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "api_rmq_reconnects",
+			Help: "The number of times the rmq connection was reestablished",
+		}),
 	}
 }
 
@@ -129,10 +129,19 @@ func (r *RedisInst) Subscribe(ctx context.Context, ch chan string, subscribeTo .
 	}()
 }
 
+// Publish a message to a channel on Redis
+func (r *RedisInst) Publish(ctx context.Context, channel string, message interface{}) error {
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
 func (r *RedisInst) Ping(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
 }
 
+func (r *RedisInst) Set(ctx context.Context, key string, value interface{}) error {
+	return r.client.Set(ctx, key, value, 0).Err()
+}
+
 func (r *RedisInst) SetEX(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
 	return r.client.SetEX(ctx, key, value, ttl).Err()
 }
@@ -141,6 +150,10 @@ func (r *RedisInst) SetNX(ctx context.Context, key string, value interface{}, tt
 	return r.client.SetNX(ctx, key, value, ttl).Result()
 }
 
+func (r *RedisInst) Del(ctx context.Context, keys ...string) error {
+	return r.client.Del(ctx, keys...).Err()
+}
+
 func (r *RedisInst) Get(ctx context.Context, key string) (interface{}, error) {
 	return r.client.Get(ctx, key).Result()
 }
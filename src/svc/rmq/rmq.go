@@ -2,43 +2,371 @@ package rmq
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/AdmiralBulldogTv/VodApi/src/instance"
+	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 )
 
+var (
+	ErrNack         = errors.New("message was not confirmed")
+	ErrNotConnected = errors.New("not connected to rmq")
+)
+
+const (
+	defaultPrefetch = 10
+	defaultPoolSize = 8
+	maxBackoff      = time.Second * 30
+)
+
+// declaration is replayed on every new connection, the broker may have lost non durable state in between.
+type declaration func(ch *amqp.Channel) error
+
+type pooledChannel struct {
+	ch   *amqp.Channel
+	conn *amqp.Connection
+}
+
 type RmqInst struct {
+	opts SetupOptions
+
+	mtx  sync.RWMutex
 	conn *amqp.Connection
-	ch   *amqp.Channel
+	// err is why there is no connection
+	err error
+
+	declMtx      sync.Mutex
+	declarations []declaration
+
+	// publishes borrow a channel and give it back while it is still open
+	pool chan pooledChannel
+
+	// confirmed publishes go through their own channel in confirm mode, one at a time
+	confirmMtx  sync.Mutex
+	confirmCh   *amqp.Channel
+	confirmConn *amqp.Connection
+	confirms    chan amqp.Confirmation
 }
 
+// New connects to rmq and reconnects with a growing backoff whenever the connection drops or could not be made, until the context is done.
 func New(ctx context.Context, opts SetupOptions) (instance.RMQ, error) {
-	conn, err := amqp.Dial(opts.URI)
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = defaultPrefetch
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+
+	r := &RmqInst{
+		opts: opts,
+		err:  ErrNotConnected,
+		pool: make(chan pooledChannel, opts.PoolSize),
+	}
+
+	// rmq may come up after us, until then Status reports why there is no connection
+	closed, err := r.connect()
 	if err != nil {
-		return nil, err
+		r.err = err
+		opts.Prometheus.RMQConnected().Set(0)
+		logrus.Error("failed to connect to rmq, retrying: ", err)
 	}
 
-	ch, err := conn.Channel()
+	go r.watch(ctx, closed)
+
+	return r, nil
+}
+
+func (r *RmqInst) connect() (chan *amqp.Error, error) {
+	conn, err := amqp.Dial(r.opts.URI)
 	if err != nil {
 		return nil, err
 	}
 
-	return &RmqInst{
-		conn: conn,
-		ch:   ch,
-	}, nil
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	r.declMtx.Lock()
+	defer r.declMtx.Unlock()
+
+	if err := replay(conn, r.declarations); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	r.mtx.Lock()
+	r.conn = conn
+	r.err = nil
+	r.mtx.Unlock()
+
+	r.opts.Prometheus.RMQConnected().Set(1)
+
+	return closed, nil
+}
+
+func replay(conn *amqp.Connection, declarations []declaration) error {
+	for _, d := range declarations {
+		ch, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+
+		err = d(ch)
+		_ = ch.Close()
+		if err != nil {
+			// the declaration went through once, so this is not going away by reconnecting
+			logrus.Error("failed to redeclare rmq topology: ", err)
+		}
+	}
+
+	return nil
+}
+
+// watch redials when the connection closes, a nil closed channel means there is no connection yet.
+func (r *RmqInst) watch(ctx context.Context, closed chan *amqp.Error) {
+	for {
+		if closed != nil {
+			select {
+			case <-ctx.Done():
+				r.mtx.Lock()
+				conn := r.conn
+				r.conn = nil
+				r.err = ErrNotConnected
+				r.mtx.Unlock()
+
+				if conn != nil {
+					_ = conn.Close()
+				}
+				return
+			case amqpErr := <-closed:
+				err := ErrNotConnected
+				if amqpErr != nil {
+					err = fmt.Errorf("connection lost: %w", amqpErr)
+				}
+
+				r.mtx.Lock()
+				r.conn = nil
+				r.err = err
+				r.mtx.Unlock()
+
+				r.opts.Prometheus.RMQConnected().Set(0)
+				logrus.Error("rmq ", err)
+			}
+		}
+
+		backoff := time.Second
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			var err error
+			if closed, err = r.connect(); err == nil {
+				break
+			}
+
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+
+			r.mtx.Lock()
+			r.err = err
+			r.mtx.Unlock()
+
+			logrus.Errorf("failed to reconnect to rmq, retrying in %s: %s", backoff, err.Error())
+		}
+
+		r.opts.Prometheus.RMQReconnects().Inc()
+		logrus.Info("reconnected to rmq")
+	}
+}
+
+func (r *RmqInst) connection() (*amqp.Connection, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if r.conn == nil {
+		return nil, r.err
+	}
+
+	return r.conn, nil
+}
+
+// Status returns why there is no connection to rmq, or nil when there is one.
+func (r *RmqInst) Status() error {
+	_, err := r.connection()
+	return err
+}
+
+// declare runs a declaration now and again on every new connection, it only runs on the next one while disconnected.
+func (r *RmqInst) declare(d declaration) error {
+	r.declMtx.Lock()
+	defer r.declMtx.Unlock()
+
+	if conn, err := r.connection(); err == nil {
+		ch, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+		defer ch.Close()
+
+		if err := d(ch); err != nil {
+			return err
+		}
+	}
+
+	r.declarations = append(r.declarations, d)
+
+	return nil
+}
+
+// QueueDeclare makes sure a durable queue exists, messages published to a missing queue are dropped.
+func (r *RmqInst) QueueDeclare(queueName string, args amqp.Table) error {
+	return r.declare(func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclare(queueName, true, false, false, false, args)
+		return err
+	})
+}
+
+// ExchangeDeclare makes sure a durable exchange exists.
+func (r *RmqInst) ExchangeDeclare(exchange string, kind string, args amqp.Table) error {
+	return r.declare(func(ch *amqp.Channel) error {
+		return ch.ExchangeDeclare(exchange, kind, true, false, false, false, args)
+	})
+}
+
+func (r *RmqInst) QueueBind(queueName string, key string, exchange string) error {
+	return r.declare(func(ch *amqp.Channel) error {
+		return ch.QueueBind(queueName, key, exchange, false, nil)
+	})
+}
+
+func (r *RmqInst) channel() (pooledChannel, error) {
+	conn, err := r.connection()
+	if err != nil {
+		return pooledChannel{}, err
+	}
+
+	for {
+		select {
+		case c := <-r.pool:
+			if c.conn == conn {
+				return c, nil
+			}
+
+			// the channel belongs to a dropped connection
+			_ = c.ch.Close()
+		default:
+			ch, err := conn.Channel()
+			return pooledChannel{ch: ch, conn: conn}, err
+		}
+	}
+}
+
+func (r *RmqInst) release(c pooledChannel) {
+	select {
+	case r.pool <- c:
+	default:
+		_ = c.ch.Close()
+	}
 }
 
 func (r *RmqInst) Publish(queueName string, msg amqp.Publishing) error {
-	return r.ch.Publish("", queueName, false, false, msg)
+	c, err := r.channel()
+	if err != nil {
+		return err
+	}
+
+	if err := c.ch.Publish("", queueName, false, false, msg); err != nil {
+		_ = c.ch.Close()
+		return err
+	}
+
+	r.release(c)
+
+	return nil
+}
+
+func (r *RmqInst) PublishConfirm(ctx context.Context, queueName string, msg amqp.Publishing) error {
+	r.confirmMtx.Lock()
+	defer r.confirmMtx.Unlock()
+
+	conn, err := r.connection()
+	if err != nil {
+		return err
+	}
+
+	if r.confirmCh != nil && r.confirmConn != conn {
+		r.closeConfirm()
+	}
+
+	if r.confirmCh == nil {
+		ch, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+
+		if err := ch.Confirm(false); err != nil {
+			_ = ch.Close()
+			return err
+		}
+
+		r.confirmCh = ch
+		r.confirmConn = conn
+		r.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	}
+
+	if err := r.confirmCh.Publish("", queueName, false, false, msg); err != nil {
+		r.closeConfirm()
+		return err
+	}
+
+	select {
+	case c, ok := <-r.confirms:
+		if !ok {
+			r.closeConfirm()
+			return amqp.ErrClosed
+		}
+		if !c.Ack {
+			return ErrNack
+		}
+
+		return nil
+	case <-ctx.Done():
+		// a late confirmation would be taken for the one of the next message
+		r.closeConfirm()
+		return ctx.Err()
+	}
 }
 
+func (r *RmqInst) closeConfirm() {
+	_ = r.confirmCh.Close()
+	r.confirmCh = nil
+}
+
+// Consume opens a channel for a consumer that takes up to the prefetch of unacknowledged messages.
+// The deliveries close with the connection, the consumer has to call Consume again.
 func (r *RmqInst) Consume(queueName string, consumer string) (*amqp.Channel, <-chan amqp.Delivery, error) {
-	ch, err := r.conn.Channel()
+	conn, err := r.connection()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch, err := conn.Channel()
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if err := ch.Qos(r.opts.Prefetch, 0, false); err != nil {
+		_ = ch.Close()
+		return nil, nil, err
+	}
+
 	msg, err := ch.Consume(queueName, consumer, false, false, false, false, nil)
 	if err != nil {
 		_ = ch.Close()
@@ -50,4 +378,9 @@ func (r *RmqInst) Consume(queueName string, consumer string) (*amqp.Channel, <-c
 
 type SetupOptions struct {
 	URI string
+	// Prefetch is how many unacknowledged messages a consumer holds at once
+	Prefetch int
+	// PoolSize is how many idle publish channels are kept open
+	PoolSize   int
+	Prometheus instance.Prometheus
 }
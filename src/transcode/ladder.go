@@ -0,0 +1,147 @@
+package transcode
+
+import (
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+)
+
+// SourceVariant keeps the source as is, it is part of every ladder since the transcoder reports the source resolution with it.
+const SourceVariant = "source"
+
+// Presets are the variants that can be used in a ladder without configuring them, bitrates are in bits per second.
+var Presets = []structures.VodVariant{
+	{Name: SourceVariant},
+	{Name: "1080p60", Width: 1920, Height: 1080, FPS: 60, Bitrate: 6000000},
+	{Name: "1080p30", Width: 1920, Height: 1080, FPS: 30, Bitrate: 4500000},
+	{Name: "720p60", Width: 1280, Height: 720, FPS: 60, Bitrate: 4500000},
+	{Name: "720p30", Width: 1280, Height: 720, FPS: 30, Bitrate: 3000000},
+	{Name: "480p30", Width: 854, Height: 480, FPS: 30, Bitrate: 1500000},
+	{Name: "360p30", Width: 640, Height: 360, FPS: 30, Bitrate: 800000},
+	{Name: "160p30", Width: 284, Height: 160, FPS: 30, Bitrate: 300000},
+	{Name: "audio_only", Bitrate: 160000, AudioOnly: true},
+}
+
+var defaultLadder = []string{SourceVariant, "720p60", "480p30", "audio_only"}
+
+// Variants returns the presets together with the configured variants.
+func Variants(gCtx global.Context) []structures.VodVariant {
+	variants := make([]structures.VodVariant, len(Presets))
+	copy(variants, Presets)
+
+	index := map[string]int{}
+	for i, v := range variants {
+		index[v.Name] = i
+	}
+
+	for _, v := range gCtx.Config().Transcode.Variants {
+		variant := structures.VodVariant{
+			Name:      v.Name,
+			Width:     v.Width,
+			Height:    v.Height,
+			FPS:       v.FPS,
+			Bitrate:   v.Bitrate,
+			AudioOnly: v.AudioOnly,
+		}
+
+		if i, ok := index[v.Name]; ok {
+			variants[i] = variant
+		} else {
+			index[v.Name] = len(variants)
+			variants = append(variants, variant)
+		}
+	}
+
+	return variants
+}
+
+// Ladder returns the variants the vods of a user are transcoded to, names that are not known are skipped.
+func Ladder(gCtx global.Context, settings structures.UserTranscodeSettings) []structures.VodVariant {
+	names := settings.Ladder
+	if len(names) == 0 {
+		names = gCtx.Config().Transcode.Ladder
+	}
+	if len(names) == 0 {
+		names = defaultLadder
+	}
+
+	variants := map[string]structures.VodVariant{}
+	for _, v := range Variants(gCtx) {
+		variants[v.Name] = v
+	}
+
+	ladder := []structures.VodVariant{variants[SourceVariant]}
+	seen := map[string]bool{SourceVariant: true}
+	for _, name := range names {
+		v, ok := variants[name]
+		if !ok || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		ladder = append(ladder, v)
+	}
+
+	return ladder
+}
+
+// Filter drops the variants with a higher resolution than the source, comparing the short edges so portrait sources keep their ladder.
+// Video variants are turned to the orientation of the source and their frame rate is capped at the one of the source,
+// a capped variant is dropped when the ladder has another one with the same resolution and frame rate.
+func Filter(variants []structures.VodVariant, source structures.VodSource) []structures.VodVariant {
+	type key struct {
+		width, height, fps int
+	}
+
+	candidates := []structures.VodVariant{}
+	capped := []bool{}
+	uncapped := map[key]bool{}
+	for _, v := range variants {
+		if v.Name == SourceVariant || v.AudioOnly {
+			candidates = append(candidates, v)
+			capped = append(capped, false)
+			continue
+		}
+
+		if shortEdge(v.Width, v.Height) > shortEdge(source.Width, source.Height) {
+			continue
+		}
+
+		if (source.Height > source.Width) != (v.Height > v.Width) {
+			v.Width, v.Height = v.Height, v.Width
+		}
+
+		c := source.FPS != 0 && v.FPS > source.FPS
+		if c {
+			v.FPS = source.FPS
+		} else {
+			uncapped[key{v.Width, v.Height, v.FPS}] = true
+		}
+
+		candidates = append(candidates, v)
+		capped = append(capped, c)
+	}
+
+	filtered := []structures.VodVariant{}
+	seen := map[key]bool{}
+	for i, v := range candidates {
+		if v.Name != SourceVariant && !v.AudioOnly {
+			k := key{v.Width, v.Height, v.FPS}
+			if seen[k] || (capped[i] && uncapped[k]) {
+				continue
+			}
+			seen[k] = true
+		}
+
+		filtered = append(filtered, v)
+	}
+
+	return filtered
+}
+
+func shortEdge(width int, height int) int {
+	if width < height {
+		return width
+	}
+
+	return height
+}
@@ -0,0 +1,140 @@
+package transcode
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/configure"
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+)
+
+func names(variants []structures.VodVariant) []string {
+	n := make([]string, len(variants))
+	for i, v := range variants {
+		n[i] = v.Name
+	}
+
+	return n
+}
+
+func preset(name string) structures.VodVariant {
+	for _, v := range Presets {
+		if v.Name == name {
+			return v
+		}
+	}
+
+	panic("unknown preset: " + name)
+}
+
+func TestLadder(t *testing.T) {
+	cfg := &configure.Config{}
+	cfg.Transcode.Ladder = []string{"source", "1080p60", "480p30", "audio_only"}
+	cfg.Transcode.Variants = []configure.TranscodeVariant{
+		{Name: "480p30", Width: 854, Height: 480, FPS: 30, Bitrate: 2000000},
+		{Name: "240p30", Width: 426, Height: 240, FPS: 30, Bitrate: 500000},
+	}
+	gCtx := global.New(context.Background(), cfg)
+
+	tests := []struct {
+		name   string
+		ladder []string
+		want   []string
+	}{
+		{name: "configured default", want: []string{"source", "1080p60", "480p30", "audio_only"}},
+		{name: "user ladder", ladder: []string{"720p30", "240p30"}, want: []string{"source", "720p30", "240p30"}},
+		{name: "unknown and duplicate names are skipped", ladder: []string{"720p30", "nope", "720p30", "source"}, want: []string{"source", "720p30"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Ladder(gCtx, structures.UserTranscodeSettings{Ladder: tt.ladder})
+			if !reflect.DeepEqual(names(got), tt.want) {
+				t.Fatalf("got %v, want %v", names(got), tt.want)
+			}
+		})
+	}
+
+	// configured variants replace the preset with the same name
+	for _, v := range Variants(gCtx) {
+		if v.Name == "480p30" && v.Bitrate != 2000000 {
+			t.Fatalf("expected the configured 480p30, got %+v", v)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	ladder := []structures.VodVariant{
+		preset("source"),
+		preset("1080p60"),
+		preset("1080p30"),
+		preset("720p60"),
+		preset("720p30"),
+		preset("480p30"),
+		preset("audio_only"),
+	}
+
+	tests := []struct {
+		name     string
+		ladder   []structures.VodVariant
+		source   structures.VodSource
+		want     []string
+		portrait bool
+	}{
+		{
+			name:   "1080p60 source keeps everything",
+			ladder: ladder,
+			source: structures.VodSource{Width: 1920, Height: 1080, FPS: 60},
+			want:   []string{"source", "1080p60", "1080p30", "720p60", "720p30", "480p30", "audio_only"},
+		},
+		{
+			name:   "720p source drops higher resolutions",
+			ladder: ladder,
+			source: structures.VodSource{Width: 1280, Height: 720, FPS: 60},
+			want:   []string{"source", "720p60", "720p30", "480p30", "audio_only"},
+		},
+		{
+			name:   "30fps source drops 60fps rungs with a 30fps counterpart",
+			ladder: ladder,
+			source: structures.VodSource{Width: 1920, Height: 1080, FPS: 30},
+			want:   []string{"source", "1080p30", "720p30", "480p30", "audio_only"},
+		},
+		{
+			name:   "30fps source caps 60fps rungs without a counterpart",
+			ladder: []structures.VodVariant{preset("source"), preset("720p60"), preset("audio_only")},
+			source: structures.VodSource{Width: 1920, Height: 1080, FPS: 30},
+			want:   []string{"source", "720p60", "audio_only"},
+		},
+		{
+			name:     "portrait source compares the short edge",
+			ladder:   ladder,
+			source:   structures.VodSource{Width: 720, Height: 1280, FPS: 60},
+			want:     []string{"source", "720p60", "720p30", "480p30", "audio_only"},
+			portrait: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Filter(tt.ladder, tt.source)
+			if !reflect.DeepEqual(names(got), tt.want) {
+				t.Fatalf("got %v, want %v", names(got), tt.want)
+			}
+
+			for _, v := range got {
+				if v.Name == SourceVariant || v.AudioOnly {
+					continue
+				}
+
+				if tt.source.FPS != 0 && v.FPS > tt.source.FPS {
+					t.Fatalf("%s: fps %d above the source", v.Name, v.FPS)
+				}
+				if (v.Height > v.Width) != tt.portrait {
+					t.Fatalf("%s: %dx%d does not match the orientation of the source", v.Name, v.Width, v.Height)
+				}
+			}
+		})
+	}
+}
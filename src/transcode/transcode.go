@@ -0,0 +1,293 @@
+package transcode
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/vods"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	DefaultJobQueue    = "vod-transcode-jobs"
+	DefaultUpdateQueue = "api-transcode-updates"
+
+	DefaultDeadLetterExchange = "vod-transcode.dlx"
+)
+
+func jobQueue(gCtx global.Context) string {
+	if q := gCtx.Config().Transcode.JobQueue; q != "" {
+		return q
+	}
+
+	return DefaultJobQueue
+}
+
+func updateQueue(gCtx global.Context) string {
+	if q := gCtx.Config().Transcode.UpdateQueue; q != "" {
+		return q
+	}
+
+	return DefaultUpdateQueue
+}
+
+func deadLetterExchange(gCtx global.Context) string {
+	if x := gCtx.Config().Transcode.DeadLetterExchange; x != "" {
+		return x
+	}
+
+	return DefaultDeadLetterExchange
+}
+
+// retryQueue holds the jobs after the given failed attempt for the backoff of the attempt, they are dead lettered back into the job queue then.
+// Every backoff step has its own queue since rabbitmq only expires the messages at the head of a queue.
+func retryQueue(gCtx global.Context, attempt int) string {
+	return jobQueue(gCtx) + ".retry." + strconv.FormatInt(retryBackoff(gCtx, attempt).Milliseconds(), 10)
+}
+
+// updateRetryQueue holds the updates that failed to be handled for updateRetryDelay, they are dead lettered back into the update queue then.
+func updateRetryQueue(gCtx global.Context) string {
+	return updateQueue(gCtx) + ".retry"
+}
+
+func deadQueue(queue string) string {
+	return queue + ".dead"
+}
+
+// declareQueues declares the job and update queues, messages that are rejected go through the dead letter exchange to their dead letter queue.
+func declareQueues(gCtx global.Context) error {
+	dlx := deadLetterExchange(gCtx)
+	if err := gCtx.Inst().RMQ.ExchangeDeclare(dlx, amqp.ExchangeDirect, nil); err != nil {
+		return err
+	}
+
+	for _, q := range []string{deadQueue(jobQueue(gCtx)), deadQueue(updateQueue(gCtx))} {
+		if err := gCtx.Inst().RMQ.QueueDeclare(q, nil); err != nil {
+			return err
+		}
+
+		if err := gCtx.Inst().RMQ.QueueBind(q, q, dlx); err != nil {
+			return err
+		}
+	}
+
+	queues := []struct {
+		name string
+		args amqp.Table
+	}{
+		{name: jobQueue(gCtx), args: amqp.Table{
+			"x-dead-letter-exchange":    dlx,
+			"x-dead-letter-routing-key": deadQueue(jobQueue(gCtx)),
+		}},
+		{name: updateQueue(gCtx), args: amqp.Table{
+			"x-dead-letter-exchange":    dlx,
+			"x-dead-letter-routing-key": deadQueue(updateQueue(gCtx)),
+		}},
+	}
+	for _, q := range queues {
+		if err := gCtx.Inst().RMQ.QueueDeclare(q.name, q.args); err != nil {
+			return err
+		}
+	}
+
+	if err := gCtx.Inst().RMQ.QueueDeclare(updateRetryQueue(gCtx), amqp.Table{
+		"x-message-ttl":             updateRetryDelay.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": updateQueue(gCtx),
+	}); err != nil {
+		return err
+	}
+
+	for attempt := 1; attempt < maxAttempts(gCtx); attempt++ {
+		if err := gCtx.Inst().RMQ.QueueDeclare(retryQueue(gCtx, attempt), amqp.Table{
+			"x-message-ttl":             retryBackoff(gCtx, attempt).Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": jobQueue(gCtx),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func maxAttempts(gCtx global.Context) int {
+	if n := gCtx.Config().Transcode.MaxAttempts; n > 0 {
+		return n
+	}
+
+	return 3
+}
+
+// retryBackoff is the delay before the next attempt after the given failed attempt.
+func retryBackoff(gCtx global.Context, attempt int) time.Duration {
+	d := gCtx.Config().Transcode.RetryBackoff
+	if d <= 0 {
+		d = time.Second * 30
+	}
+
+	return d * time.Duration(1<<(attempt-1))
+}
+
+// Dispatch moves a live vod to queued and writes the transcode jobs of the ladder of the user to the outbox.
+// Until the source resolution is known only the source is transcoded, the rest follows once the transcoder reports it.
+func Dispatch(gCtx global.Context, ctx context.Context, vod structures.Vod) error {
+	user := structures.User{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{
+		"_id": vod.UserID,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&user)
+	}
+	if err != nil {
+		return err
+	}
+
+	variants := Ladder(gCtx, user.Settings.Transcode)
+	// the ladder starts with the source
+	jobs := variants[:1]
+	if vod.Source.Height != 0 {
+		variants = Filter(variants, vod.Source)
+		jobs = variants
+	}
+
+	msgs, err := jobMessages(gCtx, vod, jobs)
+	if err != nil {
+		return err
+	}
+
+	if err := vods.Transition(gCtx, ctx, vod.ID, structures.VodStateLive, structures.VodStateQueued, vods.Change{
+		Actor:  vods.System(),
+		Reason: "publish ended",
+		Set: bson.M{
+			"variants": variants,
+		},
+		Messages: msgs,
+	}); err != nil {
+		// another instance already queued it
+		if err == vods.ErrBadTransition {
+			return nil
+		}
+
+		return err
+	}
+
+	logrus.WithField("vod_id", vod.ID.Hex()).Infof("queued %d transcode jobs", len(msgs))
+
+	return nil
+}
+
+func jobMessages(gCtx global.Context, vod structures.Vod, variants []structures.VodVariant) ([]structures.OutboxMessage, error) {
+	msgs := make([]structures.OutboxMessage, len(variants))
+	for i, v := range variants {
+		msg, err := jobMessage(jobQueue(gCtx), vod, v, v.Attempts+1)
+		if err != nil {
+			return nil, err
+		}
+
+		msgs[i] = msg
+	}
+
+	return msgs, nil
+}
+
+// jobMessage is an attempt of a variant for the outbox.
+func jobMessage(queue string, vod structures.Vod, variant structures.VodVariant, attempt int) (structures.OutboxMessage, error) {
+	data, err := json.Marshal(structures.VodTranscodeJob{
+		VodID:   vod.ID,
+		Variant: variant,
+		Attempt: attempt,
+	})
+	if err != nil {
+		return structures.OutboxMessage{}, err
+	}
+
+	return structures.OutboxMessage{
+		Queue:       queue,
+		ContentType: "application/json",
+		Body:        data,
+	}, nil
+}
+
+// Requeue moves a failed or canceled vod back to queued with the jobs of the variants that are not ready.
+func Requeue(gCtx global.Context, ctx context.Context, vod structures.Vod, actor structures.VodEventActor) (structures.Vod, error) {
+	// live vods are queued when the publish ends
+	if vod.State != structures.VodStateFailed && vod.State != structures.VodStateCanceled {
+		return vod, vods.ErrBadTransition
+	}
+
+	// the other variants follow the source when its resolution is not known yet
+	waitForSource := vod.Source.Height == 0
+	for _, v := range vod.Variants {
+		if v.Name == SourceVariant && v.Ready {
+			waitForSource = false
+		}
+	}
+
+	jobs := []structures.VodVariant{}
+	for i, v := range vod.Variants {
+		if v.Ready {
+			continue
+		}
+
+		// attempts keep counting so updates of the earlier run never match the new one
+		vod.Variants[i].Error = ""
+		vod.Variants[i].RetryBase = v.Attempts
+		if !waitForSource || v.Name == SourceVariant {
+			jobs = append(jobs, vod.Variants[i])
+		}
+	}
+	// every variant is ready already
+	if len(jobs) == 0 {
+		return vod, vods.ErrBadTransition
+	}
+
+	msgs, err := jobMessages(gCtx, vod, jobs)
+	if err != nil {
+		return vod, err
+	}
+
+	if err := vods.Transition(gCtx, ctx, vod.ID, vod.State, structures.VodStateQueued, vods.Change{
+		Actor:  actor,
+		Reason: "requeued",
+		Set: bson.M{
+			"variants": vod.Variants,
+		},
+		Messages: msgs,
+	}); err != nil {
+		return vod, err
+	}
+
+	vod.State = structures.VodStateQueued
+
+	return vod, nil
+}
+
+// Cancel stops a vod from being transcoded, updates for it are ignored until it is requeued.
+func Cancel(gCtx global.Context, ctx context.Context, vod structures.Vod, actor structures.VodEventActor) (structures.Vod, error) {
+	if err := vods.Transition(gCtx, ctx, vod.ID, vod.State, structures.VodStateCanceled, vods.Change{
+		Actor:  actor,
+		Reason: "canceled",
+	}); err != nil {
+		return vod, err
+	}
+
+	vod.State = structures.VodStateCanceled
+
+	return vod, nil
+}
+
+// active is true while the transcoder works on a vod.
+func active(state structures.VodState) bool {
+	return state == structures.VodStateQueued || state == structures.VodStateProcessing
+}
@@ -0,0 +1,391 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/outbox"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/AdmiralBulldogTv/VodApi/src/vods"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// updateRetries is how often an update that failed to be handled is retried before it is dead lettered
+	updateRetries    = 5
+	updateRetryDelay = time.Second * 10
+)
+
+// New consumes the updates of the transcoder until the context is done.
+func New(gCtx global.Context) <-chan struct{} {
+	done := make(chan struct{})
+
+	if err := declareQueues(gCtx); err != nil {
+		logrus.Fatal("failed to declare queues: ", err)
+	}
+
+	go func() {
+		defer close(done)
+
+		for {
+			if err := consume(gCtx); err != nil {
+				logrus.Error("failed to consume transcode updates: ", err)
+			}
+
+			select {
+			case <-gCtx.Done():
+				return
+			case <-time.After(time.Second * 5):
+			}
+		}
+	}()
+
+	return done
+}
+
+// consume handles updates until the delivery channel closes.
+func consume(gCtx global.Context) error {
+	ch, msgs, err := gCtx.Inst().RMQ.Consume(updateQueue(gCtx), gCtx.Config().Pod.Name)
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for {
+		select {
+		case <-gCtx.Done():
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+
+			handleDelivery(gCtx, msg)
+		}
+	}
+}
+
+func handleDelivery(gCtx global.Context, msg amqp.Delivery) {
+	update := structures.ApiTranscodeUpdate{}
+	if err := json.Unmarshal(msg.Body, &update); err != nil {
+		logrus.Errorf("bad transcode update: %s : %s", err.Error(), msg.Body)
+		_ = msg.Nack(false, false)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
+	defer cancel()
+
+	if err := handleUpdate(gCtx, ctx, update); err != nil {
+		l := logrus.WithField("vod_id", update.VodID.Hex())
+		l.Error("failed to handle transcode update: ", err)
+
+		// requeueing right away would spin on the update as long as the error lasts
+		if deaths(msg, updateRetryQueue(gCtx)) >= updateRetries {
+			_ = msg.Nack(false, false)
+			return
+		}
+
+		if err := gCtx.Inst().RMQ.PublishConfirm(ctx, updateRetryQueue(gCtx), amqp.Publishing{
+			Headers:     msg.Headers,
+			ContentType: msg.ContentType,
+			Body:        msg.Body,
+		}); err != nil {
+			l.Error("failed to delay transcode update: ", err)
+			_ = msg.Nack(false, false)
+			return
+		}
+	}
+
+	_ = msg.Ack(false)
+}
+
+// deaths is how often a message expired in a queue, rabbitmq counts it in the x-death header.
+func deaths(msg amqp.Delivery, queue string) int64 {
+	entries, _ := msg.Headers["x-death"].([]interface{})
+	for _, e := range entries {
+		entry, _ := e.(amqp.Table)
+		if entry["queue"] == queue {
+			count, _ := entry["count"].(int64)
+			return count
+		}
+	}
+
+	return 0
+}
+
+func handleUpdate(gCtx global.Context, ctx context.Context, update structures.ApiTranscodeUpdate) error {
+	l := logrus.WithFields(logrus.Fields{
+		"vod_id":  update.VodID.Hex(),
+		"variant": update.Variant.Name,
+	})
+
+	vod := structures.Vod{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOne(ctx, bson.M{
+		"_id":           update.VodID,
+		"variants.name": update.Variant.Name,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&vod)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			// the vod was deleted or the variant dropped from it, there is nothing to update
+			l.Warn("transcode update for unknown vod variant")
+			return nil
+		}
+
+		return err
+	}
+
+	if update.Error != "" {
+		return handleFailure(gCtx, ctx, l, vod, update)
+	}
+
+	res = gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOneAndUpdate(ctx, attemptFilter(update), bson.M{
+		"$set": bson.M{
+			"variants.$.ready": update.Variant.Ready,
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	err = res.Err()
+	if err == nil {
+		err = res.Decode(&vod)
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			// a redelivered update may have failed to move the vod before
+			l.Debug("ignoring stale transcode update of attempt ", update.Attempt)
+			return updateState(gCtx, ctx, vod)
+		}
+
+		return err
+	}
+
+	if active(vod.State) && update.Variant.Name == SourceVariant && update.Variant.Height != 0 && vod.Source.Height == 0 {
+		if vod, err = dispatchLadder(gCtx, ctx, vod, update.Variant); err != nil {
+			return err
+		}
+	}
+
+	return updateState(gCtx, ctx, vod)
+}
+
+// handleFailure retries a failed variant with a growing delay, after the last attempt the job is dead lettered and the variant fails.
+func handleFailure(gCtx global.Context, ctx context.Context, l *logrus.Entry, vod structures.Vod, update structures.ApiTranscodeUpdate) error {
+	variant := structures.VodVariant{}
+	for _, v := range vod.Variants {
+		if v.Name == update.Variant.Name {
+			variant = v
+		}
+	}
+
+	// a redelivered failure was counted already and failures of canceled or earlier runs are not counted at all
+	if !active(vod.State) || update.Attempt != variant.Attempts+1 {
+		l.Debug("ignoring stale transcode failure of attempt ", update.Attempt)
+		return updateState(gCtx, ctx, vod)
+	}
+
+	now := time.Now()
+	variant.Attempts++
+	// the failed attempts of this run
+	run := variant.Attempts - variant.RetryBase
+	retry := run < maxAttempts(gCtx)
+
+	set := bson.M{
+		"variants.$.ready":    false,
+		"variants.$.attempts": variant.Attempts,
+	}
+	if !retry {
+		set["variants.$.error"] = update.Error
+	}
+
+	var (
+		msg   structures.OutboxMessage
+		err   error
+		delay = retryBackoff(gCtx, run)
+	)
+	if retry {
+		msg, err = jobMessage(retryQueue(gCtx, run), vod, variant, variant.Attempts+1)
+	} else {
+		// the job is kept for inspection
+		msg, err = jobMessage(deadQueue(jobQueue(gCtx)), vod, variant, variant.Attempts)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = mongo.Transaction(ctx, gCtx.Inst().Mongo, func(ctx context.Context) error {
+		res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOneAndUpdate(ctx, attemptFilter(update), bson.M{
+			"$set": set,
+			"$push": bson.M{
+				"transcode_errors": structures.VodTranscodeError{
+					Variant:   variant.Name,
+					Attempt:   variant.Attempts,
+					Error:     update.Error,
+					Timestamp: now,
+				},
+			},
+		}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+		err := res.Err()
+		if err == nil {
+			err = res.Decode(&vod)
+		}
+		if err != nil {
+			return err
+		}
+
+		return outbox.Add(gCtx, ctx, msg)
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			// another delivery of the update got there first
+			l.Debug("ignoring stale transcode failure of attempt ", update.Attempt)
+			if vod, err = vods.Get(gCtx, ctx, vod.ID); err != nil {
+				return err
+			}
+
+			return updateState(gCtx, ctx, vod)
+		}
+
+		return err
+	}
+
+	if retry {
+		l.Warnf("transcode failed, retrying in %s: %s", delay, update.Error)
+	} else {
+		l.Error("transcode failed: ", update.Error)
+	}
+	outbox.Notify()
+
+	return updateState(gCtx, ctx, vod)
+}
+
+// attemptFilter matches the vod of an update while the transcoder works on it and the attempt of the update is the current one of the variant.
+func attemptFilter(update structures.ApiTranscodeUpdate) bson.M {
+	return bson.M{
+		"_id":       update.VodID,
+		"vod_state": bson.M{"$in": []structures.VodState{structures.VodStateQueued, structures.VodStateProcessing}},
+		"variants": bson.M{"$elemMatch": bson.M{
+			"name":     update.Variant.Name,
+			"attempts": update.Attempt - 1,
+		}},
+	}
+}
+
+// updateState moves a vod the transcoder works on to the state of its variants.
+func updateState(gCtx global.Context, ctx context.Context, vod structures.Vod) error {
+	for i := 0; ; i++ {
+		// canceled or stored vods stay where they are
+		if !active(vod.State) {
+			return nil
+		}
+
+		to := variantsState(vod.Variants)
+		if to == vod.State {
+			return nil
+		}
+
+		err := vods.Transition(gCtx, ctx, vod.ID, vod.State, to, vods.Change{
+			Actor:  vods.System(),
+			Reason: stateReason(vod.Variants, to),
+		})
+		if err != vods.ErrBadTransition || i == 2 {
+			return err
+		}
+
+		// another update changed the vod since it was read
+		if vod, err = vods.Get(gCtx, ctx, vod.ID); err != nil {
+			return err
+		}
+	}
+}
+
+func stateReason(variants []structures.VodVariant, state structures.VodState) string {
+	switch state {
+	case structures.VodStateFailed:
+		for _, v := range variants {
+			if v.Error != "" {
+				return fmt.Sprintf("variant %s failed: %s", v.Name, v.Error)
+			}
+		}
+	case structures.VodStateReady:
+		return "every variant is ready"
+	case structures.VodStateProcessing:
+		return "transcoding started"
+	}
+
+	return ""
+}
+
+// dispatchLadder stores the source resolution the transcoder reported and queues the jobs of the variants that fit it.
+func dispatchLadder(gCtx global.Context, ctx context.Context, vod structures.Vod, source structures.VodVariant) (structures.Vod, error) {
+	vod.Source = structures.VodSource{
+		Width:   source.Width,
+		Height:  source.Height,
+		FPS:     source.FPS,
+		Bitrate: source.Bitrate,
+	}
+	vod.Variants = Filter(vod.Variants, vod.Source)
+
+	jobs := []structures.VodVariant{}
+	for _, v := range vod.Variants {
+		if v.Name != SourceVariant {
+			jobs = append(jobs, v)
+		}
+	}
+
+	msgs, err := jobMessages(gCtx, vod, jobs)
+	if err != nil {
+		return vod, err
+	}
+
+	err = mongo.Transaction(ctx, gCtx.Inst().Mongo, func(ctx context.Context) error {
+		res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).UpdateOne(ctx, bson.M{
+			"_id": vod.ID,
+			// redelivered updates must not queue the jobs twice
+			"source.height": bson.M{"$not": bson.M{"$gt": 0}},
+		}, bson.M{
+			"$set": bson.M{
+				"source":   vod.Source,
+				"variants": vod.Variants,
+			},
+		})
+		if err != nil || res.ModifiedCount == 0 {
+			return err
+		}
+
+		return outbox.Add(gCtx, ctx, msgs...)
+	})
+	if err != nil {
+		return vod, err
+	}
+
+	outbox.Notify()
+
+	return vod, nil
+}
+
+// variantsState is failed when any variant failed, ready when every variant is ready and processing otherwise.
+func variantsState(variants []structures.VodVariant) structures.VodState {
+	ready := true
+	for _, v := range variants {
+		if v.Error != "" {
+			return structures.VodStateFailed
+		}
+
+		ready = ready && v.Ready
+	}
+
+	if ready {
+		return structures.VodStateReady
+	}
+
+	return structures.VodStateProcessing
+}
@@ -0,0 +1,32 @@
+package transcode
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestDeaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int64
+	}{
+		{name: "no header", want: 0},
+		{name: "other queue", headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"queue": "other", "reason": "expired", "count": int64(3)},
+		}}, want: 0},
+		{name: "retry queue", headers: amqp.Table{"x-death": []interface{}{
+			amqp.Table{"queue": "other", "reason": "rejected", "count": int64(1)},
+			amqp.Table{"queue": "updates.retry", "reason": "expired", "count": int64(2)},
+		}}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deaths(amqp.Delivery{Headers: tt.headers}, "updates.retry"); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package twitch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/instance"
+	"github.com/go-redis/redis/v8"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+)
+
+// tokenSource hands out an access token until it expires or helix rejects it.
+type tokenSource struct {
+	key   string
+	redis instance.Redis
+	fetch func(ctx context.Context) (helix.AccessCredentials, error)
+
+	limit rateLimit
+
+	mtx       sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newTokenSource(key string, redisInst instance.Redis, fetch func(ctx context.Context) (helix.AccessCredentials, error)) *tokenSource {
+	return &tokenSource{
+		key:   key,
+		redis: redisInst,
+		fetch: fetch,
+	}
+}
+
+func (t *tokenSource) Token(ctx context.Context) (string, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.token != "" && time.Now().Before(t.expiresAt) {
+		return t.token, nil
+	}
+
+	if t.redis != nil {
+		token, err := t.redis.Get(ctx, t.key)
+		if err == nil {
+			// redis owns the expiry, so we only hold onto the token for a short while
+			t.token = token.(string)
+			t.expiresAt = time.Now().Add(time.Minute)
+			return t.token, nil
+		}
+
+		if err != redis.Nil {
+			logrus.Error("failed to query redis: ", err)
+		}
+	}
+
+	creds, err := t.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := time.Second * time.Duration(creds.ExpiresIn)
+	if t.redis != nil {
+		if err := t.redis.SetEX(ctx, t.key, creds.AccessToken, ttl); err != nil {
+			logrus.Error("failed to store token in redis: ", err)
+		}
+	}
+
+	t.token = creds.AccessToken
+	t.expiresAt = time.Now().Add(ttl)
+
+	return t.token, nil
+}
+
+// Invalidate forgets a token helix rejected so the next request fetches a new one.
+func (t *tokenSource) Invalidate(ctx context.Context, token string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.token == token {
+		t.token = ""
+	}
+
+	if t.redis != nil {
+		// another instance may have replaced it already
+		if cur, err := t.redis.Get(ctx, t.key); err == nil && cur.(string) == token {
+			if err := t.redis.Del(ctx, t.key); err != nil {
+				logrus.Error("failed to remove token from redis: ", err)
+			}
+		}
+	}
+}
+
+type authClient struct {
+	url          string
+	http         *http.Client
+	clientID     string
+	clientSecret string
+	redis        instance.Redis
+}
+
+func (a *authClient) appToken(ctx context.Context) (helix.AccessCredentials, error) {
+	v := url.Values{}
+
+	v.Set("client_id", a.clientID)
+	v.Set("client_secret", a.clientSecret)
+	v.Set("grant_type", "client_credentials")
+
+	return a.requestToken(ctx, v)
+}
+
+// userToken fetches user tokens with a refresh token.
+// Twitch may hand out a new refresh token on every refresh, the latest one is kept in redis.
+func (a *authClient) userToken(refreshToken string) func(ctx context.Context) (helix.AccessCredentials, error) {
+	return func(ctx context.Context) (helix.AccessCredentials, error) {
+		current := refreshToken
+		if a.redis != nil {
+			if stored, err := a.redis.Get(ctx, "twitch:user-refresh-token"); err == nil {
+				current = stored.(string)
+			}
+		}
+
+		if current == "" {
+			return helix.AccessCredentials{}, ErrNoRefreshToken
+		}
+
+		v := url.Values{}
+
+		v.Set("client_id", a.clientID)
+		v.Set("client_secret", a.clientSecret)
+		v.Set("grant_type", "refresh_token")
+		v.Set("refresh_token", current)
+
+		creds, err := a.requestToken(ctx, v)
+		if err != nil {
+			return creds, err
+		}
+
+		if a.redis != nil && creds.RefreshToken != "" && creds.RefreshToken != current {
+			if err := a.redis.Set(ctx, "twitch:user-refresh-token", creds.RefreshToken); err != nil {
+				logrus.Error("failed to store refresh token in redis: ", err)
+			}
+		}
+
+		return creds, nil
+	}
+}
+
+func (a *authClient) requestToken(ctx context.Context, v url.Values) (helix.AccessCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", a.url+"/token", strings.NewReader(v.Encode()))
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return helix.AccessCredentials{}, err
+	}
+
+	if resp.StatusCode > 299 {
+		return helix.AccessCredentials{}, newError(resp.StatusCode, data)
+	}
+
+	tokenResp := helix.AccessCredentials{}
+	err = json.Unmarshal(data, &tokenResp)
+
+	return tokenResp, err
+}
+
+// TokenValidation describes a user access token.
+type TokenValidation struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	UserID    string   `json:"user_id"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// ValidateToken asks twitch who a token belongs to, invalid tokens return an Error with a 401 status.
+func (c *Client) ValidateToken(ctx context.Context, token string) (TokenValidation, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.auth.url+"/validate", nil)
+	if err != nil {
+		return TokenValidation{}, err
+	}
+	req.Header.Set("Authorization", "OAuth "+token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return TokenValidation{}, err
+	}
+
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return TokenValidation{}, err
+	}
+
+	if resp.StatusCode > 299 {
+		return TokenValidation{}, newError(resp.StatusCode, data)
+	}
+
+	validation := TokenValidation{}
+	err = json.Unmarshal(data, &validation)
+
+	return validation, err
+}
@@ -0,0 +1,26 @@
+package twitch
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/nicklaw5/helix"
+)
+
+// GetChannelInformation returns the current title, category and language of a channel.
+func (c *Client) GetChannelInformation(ctx context.Context, broadcasterID string) (helix.ChannelInformation, error) {
+	channelsResp := helix.ManyChannelInformation{}
+	if err := c.do(ctx, request{
+		method: "GET",
+		path:   "/channels",
+		query:  url.Values{"broadcaster_id": []string{broadcasterID}},
+	}, &channelsResp); err != nil {
+		return helix.ChannelInformation{}, err
+	}
+
+	if len(channelsResp.Channels) == 0 {
+		return helix.ChannelInformation{}, ErrNoChannel
+	}
+
+	return channelsResp.Channels[0], nil
+}
@@ -0,0 +1,253 @@
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/instance"
+)
+
+const (
+	DefaultHelixURL = "https://api.twitch.tv/helix"
+	DefaultAuthURL  = "https://id.twitch.tv/oauth2"
+)
+
+// Client talks to helix. It waits out rate limits, retries failed requests and replaces tokens helix rejects.
+type Client struct {
+	clientID string
+	baseURL  string
+	http     *http.Client
+	redis    instance.Redis
+
+	maxRetries int
+	backoff    time.Duration
+
+	auth *authClient
+	app  *tokenSource
+	user *tokenSource
+}
+
+type Options struct {
+	ClientID     string
+	ClientSecret string
+	// RefreshToken is only needed for requests that require a user token
+	RefreshToken string
+
+	BaseURL    string
+	AuthURL    string
+	HTTPClient *http.Client
+
+	// Redis shares tokens and cached responses between instances, it is optional
+	Redis instance.Redis
+
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+func NewClient(opts Options) *Client {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultHelixURL
+	}
+	if opts.AuthURL == "" {
+		opts.AuthURL = DefaultAuthURL
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: time.Second * 10}
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Millisecond * 500
+	}
+
+	auth := &authClient{
+		url:          opts.AuthURL,
+		http:         opts.HTTPClient,
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		redis:        opts.Redis,
+	}
+
+	return &Client{
+		clientID:   opts.ClientID,
+		baseURL:    opts.BaseURL,
+		http:       opts.HTTPClient,
+		redis:      opts.Redis,
+		maxRetries: opts.MaxRetries,
+		backoff:    opts.Backoff,
+		auth:       auth,
+		app:        newTokenSource("twitch:app-token", opts.Redis, auth.appToken),
+		user:       newTokenSource("twitch:user-token", opts.Redis, auth.userToken(opts.RefreshToken)),
+	}
+}
+
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	// user requests are made with the user token instead of the app token
+	user bool
+}
+
+// do sends a request to helix and decodes the response into out when it is not nil.
+func (c *Client) do(ctx context.Context, req request, out interface{}) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return err
+		}
+	}
+
+	u := c.baseURL + req.path
+	if len(req.query) != 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	tokens := c.app
+	if req.user {
+		tokens = c.user
+	}
+
+	// a request that may have been handled already must not be sent again
+	idempotent := req.method != http.MethodPost && req.method != http.MethodPatch
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt != 0 {
+			if err := sleep(ctx, c.backoff*time.Duration(1<<(attempt-1))); err != nil {
+				return err
+			}
+		}
+
+		if err := tokens.limit.wait(ctx); err != nil {
+			return err
+		}
+
+		tkn, err := tokens.Token(ctx)
+		if err != nil {
+			// a misconfigured client will not fix itself
+			if IsStatus(err, http.StatusBadRequest) || err == ErrNoRefreshToken {
+				return err
+			}
+
+			lastErr = err
+			continue
+		}
+
+		hreq, err := http.NewRequestWithContext(ctx, req.method, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		hreq.Header.Set("Client-Id", c.clientID)
+		hreq.Header.Set("Authorization", "Bearer "+tkn)
+		if body != nil {
+			hreq.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.http.Do(hreq)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			lastErr = err
+			if !idempotent {
+				return lastErr
+			}
+			continue
+		}
+
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		tokens.limit.update(resp.Header)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode < 300 {
+			if out == nil || len(data) == 0 {
+				return nil
+			}
+
+			return json.Unmarshal(data, out)
+		}
+
+		lastErr = newError(resp.StatusCode, data)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			tokens.Invalidate(ctx, tkn)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			// the rate limit headers tell us how long to wait
+		case resp.StatusCode >= 500 && idempotent:
+		default:
+			return lastErr
+		}
+	}
+
+	return lastErr
+}
+
+// rateLimit follows the token bucket helix reports in the response headers.
+type rateLimit struct {
+	mtx       sync.Mutex
+	remaining int
+	reset     time.Time
+}
+
+// wait takes a slot of the bucket, once it is empty callers wait until it resets.
+// Before the first response and after a reset helix tells us what is left with the next response.
+func (r *rateLimit) wait(ctx context.Context) error {
+	for {
+		r.mtx.Lock()
+		d := time.Until(r.reset)
+		if r.remaining > 0 || r.reset.IsZero() || d <= 0 {
+			r.remaining--
+			r.mtx.Unlock()
+			return nil
+		}
+		r.mtx.Unlock()
+
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *rateLimit) update(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.ParseInt(h.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.mtx.Lock()
+	r.remaining = remaining
+	r.reset = time.Unix(reset, 0)
+	r.mtx.Unlock()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
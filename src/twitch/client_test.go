@@ -0,0 +1,157 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHelix hands out numbered app tokens and answers helix requests with the statuses it is given, one per request.
+type fakeHelix struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	tokens   int
+	statuses []int
+	requests []*http.Request
+}
+
+func newFakeHelix(t *testing.T, statuses ...int) *fakeHelix {
+	f := &fakeHelix{statuses: statuses}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+
+		if r.URL.Path == "/auth/token" {
+			f.tokens++
+			fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600}`, f.tokens)
+			return
+		}
+
+		f.requests = append(f.requests, r)
+		status := http.StatusOK
+		if len(f.statuses) != 0 {
+			status, f.statuses = f.statuses[0], f.statuses[1:]
+		}
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeHelix) client() *Client {
+	return NewClient(Options{
+		ClientID: "client",
+		BaseURL:  f.URL + "/helix",
+		AuthURL:  f.URL + "/auth",
+		Backoff:  time.Millisecond,
+	})
+}
+
+func (f *fakeHelix) sent() []*http.Request {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.requests
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		requests int
+		status   int
+	}{
+		{name: "get is retried after a 5xx", method: http.MethodGet, statuses: []int{503, 502}, requests: 3},
+		{name: "delete is retried after a 5xx", method: http.MethodDelete, statuses: []int{500}, requests: 2},
+		{name: "post is not retried after a 5xx", method: http.MethodPost, statuses: []int{503}, requests: 1, status: 503},
+		{name: "post is retried after a 429", method: http.MethodPost, statuses: []int{429}, requests: 2},
+		{name: "4xx is not retried", method: http.MethodGet, statuses: []int{404}, requests: 1, status: 404},
+		{name: "retries give up", method: http.MethodGet, statuses: []int{500, 500, 500, 500, 500}, requests: 4, status: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeHelix(t, tt.statuses...)
+
+			err := f.client().do(context.Background(), request{method: tt.method, path: "/test"}, nil)
+			if tt.status == 0 && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.status != 0 && !IsStatus(err, tt.status) {
+				t.Fatalf("expected status %d, got %v", tt.status, err)
+			}
+
+			if n := len(f.sent()); n != tt.requests {
+				t.Fatalf("expected %d requests, got %d", tt.requests, n)
+			}
+		})
+	}
+}
+
+func TestDoInvalidatesRejectedToken(t *testing.T) {
+	f := newFakeHelix(t, http.StatusUnauthorized)
+
+	if err := f.client().do(context.Background(), request{method: http.MethodGet, path: "/test"}, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	sent := f.sent()
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(sent))
+	}
+
+	for i, want := range []string{"Bearer token-1", "Bearer token-2"} {
+		if got := sent[i].Header.Get("Authorization"); got != want {
+			t.Fatalf("request %d: expected %q, got %q", i, want, got)
+		}
+	}
+}
+
+func TestRateLimitCountdown(t *testing.T) {
+	r := &rateLimit{remaining: 2, reset: time.Now().Add(time.Hour)}
+
+	for i := 0; i < 2; i++ {
+		if err := r.wait(context.Background()); err != nil {
+			t.Fatalf("wait %d: unexpected error: %s", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if err := r.wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the empty bucket to block, got %v", err)
+	}
+
+	r.mtx.Lock()
+	r.reset = time.Now().Add(time.Millisecond * 20)
+	r.mtx.Unlock()
+
+	start := time.Now()
+	if err := r.wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d := time.Since(start); d < time.Millisecond*10 {
+		t.Fatalf("expected to wait for the reset, waited %s", d)
+	}
+}
+
+func TestRateLimitUnknown(t *testing.T) {
+	r := &rateLimit{}
+
+	// before the first response nothing is known about the bucket
+	for i := 0; i < 5; i++ {
+		if err := r.wait(context.Background()); err != nil {
+			t.Fatalf("wait %d: unexpected error: %s", i, err)
+		}
+	}
+}
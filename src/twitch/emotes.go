@@ -0,0 +1,145 @@
+package twitch
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EmoteFormat string
+
+const (
+	EmoteFormatStatic   EmoteFormat = "static"
+	EmoteFormatAnimated EmoteFormat = "animated"
+	// EmoteFormatDefault makes the cdn serve the animated version when there is one
+	EmoteFormatDefault EmoteFormat = "default"
+)
+
+type EmoteTheme string
+
+const (
+	EmoteThemeDark  EmoteTheme = "dark"
+	EmoteThemeLight EmoteTheme = "light"
+)
+
+// EmoteURLs returns the v2 cdn urls of an emote for every scale.
+func EmoteURLs(id string, format EmoteFormat, theme EmoteTheme) []string {
+	return []string{
+		fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v2/%s/%s/%s/1.0", id, format, theme),
+		fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v2/%s/%s/%s/2.0", id, format, theme),
+		fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v2/%s/%s/%s/3.0", id, format, theme),
+	}
+}
+
+var emoteClient = &http.Client{Timeout: time.Second * 5}
+
+// GetEmoteFormat asks the cdn whether an emote has an animated version.
+func GetEmoteFormat(ctx context.Context, id string) (EmoteFormat, error) {
+	// only emotes created on the v2 system can be animated
+	if !strings.HasPrefix(id, "emotesv2_") {
+		return EmoteFormatStatic, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", EmoteURLs(id, EmoteFormatAnimated, EmoteThemeDark)[0], nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := emoteClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return EmoteFormatAnimated, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return EmoteFormatStatic, nil
+	}
+
+	return "", fmt.Errorf("bad status resp: %d", resp.StatusCode)
+}
+
+// EmoteFormats remembers the format of the most recently used emotes for a while.
+type EmoteFormats struct {
+	size int
+	ttl  time.Duration
+
+	mtx     sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type emoteFormatEntry struct {
+	id        string
+	format    EmoteFormat
+	expiresAt time.Time
+}
+
+func NewEmoteFormats(size int, ttl time.Duration) *EmoteFormats {
+	return &EmoteFormats{
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Cached returns the format of an emote without looking it up.
+func (e *EmoteFormats) Cached(id string) (EmoteFormat, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	el, ok := e.entries[id]
+	if !ok {
+		return "", false
+	}
+
+	entry := el.Value.(*emoteFormatEntry)
+	if time.Now().After(entry.expiresAt) {
+		e.lru.Remove(el)
+		delete(e.entries, id)
+		return "", false
+	}
+
+	e.lru.MoveToFront(el)
+
+	return entry.format, true
+}
+
+// Get returns the format of an emote and looks it up on the cdn when it is not cached, failed lookups are not cached.
+func (e *EmoteFormats) Get(ctx context.Context, id string) (EmoteFormat, error) {
+	if format, ok := e.Cached(id); ok {
+		return format, nil
+	}
+
+	format, err := GetEmoteFormat(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if el, ok := e.entries[id]; ok {
+		e.lru.Remove(el)
+	}
+	e.entries[id] = e.lru.PushFront(&emoteFormatEntry{
+		id:        id,
+		format:    format,
+		expiresAt: time.Now().Add(e.ttl),
+	})
+
+	for e.lru.Len() > e.size {
+		el := e.lru.Back()
+		e.lru.Remove(el)
+		delete(e.entries, el.Value.(*emoteFormatEntry).id)
+	}
+
+	return format, nil
+}
@@ -0,0 +1,50 @@
+package twitch
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoRefreshToken = errors.New("no refresh token configured")
+	ErrNoSubscription = errors.New("no subscription in resp")
+	ErrNoChannel      = errors.New("no channel in resp")
+)
+
+// Error is a response from helix or the auth server that was not successful.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("bad status resp: %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("bad status resp: %d: %s", e.StatusCode, e.Message)
+}
+
+func newError(status int, data []byte) *Error {
+	body := struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}{}
+	_ = json.Unmarshal(data, &body)
+
+	msg := body.Message
+	if msg == "" {
+		msg = body.Error
+	}
+
+	return &Error{
+		StatusCode: status,
+		Message:    msg,
+	}
+}
+
+// IsStatus reports whether err is an Error with the status code.
+func IsStatus(err error, status int) bool {
+	e := &Error{}
+	return errors.As(err, &e) && e.StatusCode == status
+}
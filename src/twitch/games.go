@@ -0,0 +1,62 @@
+package twitch
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nicklaw5/helix"
+	"github.com/sirupsen/logrus"
+)
+
+// GetGames returns the games with the given ids, unknown ids are left out.
+func (c *Client) GetGames(ctx context.Context, ids ...string) ([]helix.Game, error) {
+	games := []helix.Game{}
+	query := url.Values{}
+
+	for _, id := range ids {
+		if c.redis != nil {
+			cached, err := c.redis.Get(ctx, "twitch:game:"+id)
+			if err == nil {
+				game := helix.Game{}
+				if err := json.UnmarshalFromString(cached.(string), &game); err == nil {
+					games = append(games, game)
+					continue
+				}
+
+				logrus.Warn("bad cache value for game: ", id)
+			} else if err != redis.Nil {
+				logrus.Error("failed to query redis: ", err)
+			}
+		}
+
+		query.Add("id", id)
+	}
+
+	if len(query) == 0 {
+		return games, nil
+	}
+
+	gamesResp := helix.ManyGames{}
+	if err := c.do(ctx, request{
+		method: "GET",
+		path:   "/games",
+		query:  query,
+	}, &gamesResp); err != nil {
+		return nil, err
+	}
+
+	for _, game := range gamesResp.Games {
+		if c.redis != nil {
+			data, _ := json.Marshal(game)
+			if err := c.redis.SetEX(ctx, "twitch:game:"+game.ID, data, time.Hour*24); err != nil {
+				logrus.Error("failed to store game in redis: ", err)
+			}
+		}
+
+		games = append(games, game)
+	}
+
+	return games, nil
+}
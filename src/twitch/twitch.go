@@ -1,17 +1,11 @@
 package twitch
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/AdmiralBulldogTv/VodApi/src/global"
 	"github.com/go-redis/redis/v8"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/nicklaw5/helix"
@@ -20,149 +14,153 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
-func GetEventSubs(gCtx global.Context, ctx context.Context) ([]helix.EventSubSubscription, error) {
+func (c *Client) GetEventSubs(ctx context.Context) ([]helix.EventSubSubscription, error) {
 	subs := []helix.EventSubSubscription{}
-	after := ""
+	query := url.Values{}
 
-start:
-	url := "https://api.twitch.tv/helix/eventsub/subscriptions"
-	if after != "" {
-		url = url + "?after=" + after
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Client-Id", gCtx.Config().Twitch.ClientID)
-	tkn, err := GetAuth(gCtx, ctx)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+tkn)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+	for {
+		webhookResp := helix.ManyEventSubSubscriptions{}
+		if err := c.do(ctx, request{
+			method: "GET",
+			path:   "/eventsub/subscriptions",
+			query:  query,
+		}, &webhookResp); err != nil {
+			return nil, err
+		}
 
-	webhookResp := helix.ManyEventSubSubscriptions{}
-	if err := json.Unmarshal(data, &webhookResp); err != nil {
-		return nil, err
-	}
+		subs = append(subs, webhookResp.EventSubSubscriptions...)
+		if webhookResp.Pagination.Cursor == "" {
+			return subs, nil
+		}
 
-	subs = append(subs, webhookResp.EventSubSubscriptions...)
-	if webhookResp.Pagination.Cursor != "" {
-		after = webhookResp.Pagination.Cursor
-		goto start
+		query.Set("after", webhookResp.Pagination.Cursor)
 	}
+}
 
-	return subs, nil
+// EventSubRequest creates a subscription, helix does not know about websocket sessions so we have our own.
+type EventSubRequest struct {
+	Type      string                  `json:"type"`
+	Version   string                  `json:"version"`
+	Condition helix.EventSubCondition `json:"condition"`
+	Transport EventSubTransport       `json:"transport"`
 }
 
-func CreateEventSub(gCtx global.Context, ctx context.Context, hook helix.EventSubSubscription) (helix.EventSubSubscription, error) {
-	data, _ := json.Marshal(hook)
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.twitch.tv/helix/eventsub/subscriptions", bytes.NewReader(data))
-	if err != nil {
-		return helix.EventSubSubscription{}, err
-	}
+type EventSubTransport struct {
+	Method    string `json:"method"`
+	Callback  string `json:"callback,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+}
 
-	auth, err := GetAuth(gCtx, ctx)
-	if err != nil {
-		return helix.EventSubSubscription{}, err
-	}
-	req.Header.Set("Authorization", "Bearer "+auth)
-	req.Header.Set("Client-ID", gCtx.Config().Twitch.ClientID)
-	req.Header.Set("Content-Type", "application/json")
+// CreateEventSub creates a subscription, a subscription that already exists is returned as is.
+func (c *Client) CreateEventSub(ctx context.Context, hook EventSubRequest) (helix.EventSubSubscription, error) {
+	webhookResp := helix.ManyEventSubSubscriptions{}
+	if err := c.do(ctx, request{
+		method: "POST",
+		path:   "/eventsub/subscriptions",
+		body:   hook,
+		// websocket subscriptions can only be created with a user token
+		user: hook.Transport.Method == "websocket",
+	}, &webhookResp); err != nil {
+		// an earlier request that timed out may have created it
+		if IsStatus(err, http.StatusConflict) {
+			return c.findEventSub(ctx, hook)
+		}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
 		return helix.EventSubSubscription{}, err
 	}
 
-	defer resp.Body.Close()
-	data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return helix.EventSubSubscription{}, err
+	if len(webhookResp.EventSubSubscriptions) == 0 {
+		return helix.EventSubSubscription{}, ErrNoSubscription
 	}
 
-	err = json.Unmarshal(data, &hook)
-	return hook, err
+	return webhookResp.EventSubSubscriptions[0], nil
 }
 
-func DeleteEventSub(gCtx global.Context, ctx context.Context, id string) error {
-	req, err := http.NewRequestWithContext(ctx, "DELETE", "https://api.twitch.tv/helix/eventsub/subscriptions?id="+id, nil)
+func (c *Client) findEventSub(ctx context.Context, hook EventSubRequest) (helix.EventSubSubscription, error) {
+	subs, err := c.GetEventSubs(ctx)
 	if err != nil {
-		return err
+		return helix.EventSubSubscription{}, err
 	}
 
-	auth, err := GetAuth(gCtx, ctx)
-	if err != nil {
-		return err
+	for _, sub := range subs {
+		if sub.Type == hook.Type && sub.Version == hook.Version && sub.Condition == hook.Condition && sub.Transport.Method == hook.Transport.Method {
+			return sub, nil
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+auth)
-	req.Header.Set("Client-ID", gCtx.Config().Twitch.ClientID)
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
+	return helix.EventSubSubscription{}, ErrNoSubscription
+}
 
-	defer resp.Body.Close()
-	if resp.StatusCode > 299 {
-		return fmt.Errorf("bad status resp: %d", resp.StatusCode)
-	}
+func (c *Client) DeleteEventSub(ctx context.Context, id string) error {
+	return c.do(ctx, request{
+		method: "DELETE",
+		path:   "/eventsub/subscriptions",
+		query:  url.Values{"id": []string{id}},
+	}, nil)
+}
 
-	return nil
+type ChatBadgeSet struct {
+	SetID    string             `json:"set_id"`
+	Versions []ChatBadgeVersion `json:"versions"`
 }
 
-func GetAuth(gCtx global.Context, ctx context.Context) (string, error) {
-	token, err := gCtx.Inst().Redis.Get(ctx, "twitch:app-token")
-	if err == nil {
-		return token.(string), nil
-	}
+type ChatBadgeVersion struct {
+	ID          string `json:"id"`
+	ImageURL1x  string `json:"image_url_1x"`
+	ImageURL2x  string `json:"image_url_2x"`
+	ImageURL4x  string `json:"image_url_4x"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
 
-	if err != redis.Nil {
-		logrus.Error("failed to query redis: ", err)
-	}
+// GetGlobalChatBadges returns the chat badges that are available in every channel.
+func (c *Client) GetGlobalChatBadges(ctx context.Context) ([]ChatBadgeSet, error) {
+	return c.getChatBadges(ctx, nil, "twitch:chat-badges:global")
+}
 
-	v := url.Values{}
+// GetChannelChatBadges returns the custom chat badges of a channel, such as subscriber and bits badges.
+func (c *Client) GetChannelChatBadges(ctx context.Context, broadcasterID string) ([]ChatBadgeSet, error) {
+	return c.getChatBadges(ctx, url.Values{"broadcaster_id": []string{broadcasterID}}, "twitch:chat-badges:"+broadcasterID)
+}
 
-	v.Set("client_id", gCtx.Config().Twitch.ClientID)
-	v.Set("client_secret", gCtx.Config().Twitch.ClientSecret)
-	v.Set("grant_type", "client_credentials")
+func (c *Client) getChatBadges(ctx context.Context, query url.Values, cacheKey string) ([]ChatBadgeSet, error) {
+	badgesResp := struct {
+		Data []ChatBadgeSet `json:"data"`
+	}{}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://id.twitch.tv/oauth2/token", strings.NewReader(v.Encode()))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Content-Length", strconv.Itoa(len(v.Encode())))
+	if c.redis != nil {
+		cached, err := c.redis.Get(ctx, cacheKey)
+		if err == nil {
+			if err := json.UnmarshalFromString(cached.(string), &badgesResp.Data); err == nil {
+				return badgesResp.Data, nil
+			}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
+			logrus.Warn("bad cache value for chat badges: ", cacheKey)
+		} else if err != redis.Nil {
+			logrus.Error("failed to query redis: ", err)
+		}
 	}
 
-	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	path := "/chat/badges/global"
+	if query != nil {
+		path = "/chat/badges"
 	}
 
-	tokenResp := helix.AccessCredentials{}
-	if err := json.Unmarshal(data, &tokenResp); err != nil {
-		return "", err
+	if err := c.do(ctx, request{
+		method: "GET",
+		path:   path,
+		query:  query,
+	}, &badgesResp); err != nil {
+		return nil, err
 	}
 
-	if err := gCtx.Inst().Redis.SetEX(ctx, "twitch:app-token", tokenResp.AccessToken, time.Second*time.Duration(tokenResp.ExpiresIn)); err != nil {
-		logrus.Error("failed to store token in redis: ", err)
+	if c.redis != nil {
+		data, _ := json.Marshal(badgesResp.Data)
+		if err := c.redis.SetEX(ctx, cacheKey, data, time.Hour); err != nil {
+			logrus.Error("failed to store chat badges in redis: ", err)
+		}
 	}
 
-	return tokenResp.AccessToken, nil
+	return badgesResp.Data, nil
 }
@@ -0,0 +1,252 @@
+package twitch_chat
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/twitch"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// badgeCache keeps the helix badge sets in memory, sets are served stale while they are refreshed in the background.
+// Badges of messages that were stored before their set loaded are filled in through the writer once it has.
+type badgeCache struct {
+	gCtx   global.Context
+	writer *chatWriter
+
+	ttl   time.Duration
+	retry time.Duration
+
+	mtx      sync.Mutex
+	global   *badgeSet
+	channels map[string]*badgeSet
+	pending  map[pendingBadge]bool
+}
+
+type badgeSet struct {
+	// versions is keyed by set id and then version id, it is nil until the set loaded once
+	versions   map[string]map[string]twitch.ChatBadgeVersion
+	expiresAt  time.Time
+	refreshing bool
+}
+
+// pendingBadge is a badge that was stored without urls on the messages of a vod.
+type pendingBadge struct {
+	channelID string
+	setID     string
+	version   string
+	vodID     primitive.ObjectID
+}
+
+const maxPendingBadges = 10000
+
+func newBadgeCache(gCtx global.Context, writer *chatWriter) *badgeCache {
+	return &badgeCache{
+		gCtx:     gCtx,
+		writer:   writer,
+		ttl:      time.Hour,
+		retry:    time.Second * 30,
+		global:   &badgeSet{},
+		channels: map[string]*badgeSet{},
+		pending:  map[pendingBadge]bool{},
+	}
+}
+
+// Warm starts loading the badges of a channel so they are ready before its first message.
+func (b *badgeCache) Warm(channelID string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.revalidate(b.global, "")
+	b.revalidate(b.channel(channelID), channelID)
+}
+
+// Resolve looks up a badge version, channel badges take priority over global ones.
+// A badge that is not known yet is set on the messages of the vod when its set loads.
+func (b *badgeCache) Resolve(channelID string, setID string, version string, vodID primitive.ObjectID) (twitch.ChatBadgeVersion, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.revalidate(b.global, "")
+	b.revalidate(b.channel(channelID), channelID)
+
+	v, ok, loaded := b.lookup(channelID, setID, version)
+	if !ok && !loaded && len(b.pending) < maxPendingBadges {
+		b.pending[pendingBadge{channelID: channelID, setID: setID, version: version, vodID: vodID}] = true
+	}
+
+	return v, ok
+}
+
+// lookup must be called while holding the lock, loaded is true once both sets the badge can be in have loaded.
+func (b *badgeCache) lookup(channelID string, setID string, version string) (v twitch.ChatBadgeVersion, ok bool, loaded bool) {
+	set := b.channel(channelID)
+	if v, ok = set.versions[setID][version]; ok {
+		return v, true, true
+	}
+
+	v, ok = b.global.versions[setID][version]
+	return v, ok, set.versions != nil && b.global.versions != nil
+}
+
+// backfill must be called while holding the lock, it returns the updates of the pending badges that resolve now.
+func (b *badgeCache) backfill() []chatUpdate {
+	updates := []chatUpdate{}
+	for p := range b.pending {
+		v, ok, loaded := b.lookup(p.channelID, p.setID, p.version)
+		if !ok {
+			// badges helix does not know keep the set id as their name
+			if loaded {
+				delete(b.pending, p)
+			}
+			continue
+		}
+
+		delete(b.pending, p)
+		updates = append(updates, chatUpdate{
+			filter: bson.M{
+				"vod_id":         p.vodID,
+				"badges.set_id":  p.setID,
+				"badges.version": p.version,
+			},
+			update: bson.M{
+				"$set": bson.M{
+					"badges.$[b].name": badgeName(v, p.setID),
+					"badges.$[b].urls": badgeURLs(v),
+				},
+			},
+			arrayFilters: []interface{}{bson.M{
+				"b.set_id":  p.setID,
+				"b.version": p.version,
+				"b.urls":    bson.M{"$size": 0},
+			}},
+		})
+	}
+
+	return updates
+}
+
+// channel must be called while holding the lock.
+func (b *badgeCache) channel(channelID string) *badgeSet {
+	set, ok := b.channels[channelID]
+	if !ok {
+		set = &badgeSet{}
+		b.channels[channelID] = set
+	}
+
+	return set
+}
+
+// revalidate must be called while holding the lock.
+func (b *badgeCache) revalidate(set *badgeSet, channelID string) {
+	if set.refreshing || time.Now().Before(set.expiresAt) {
+		return
+	}
+
+	set.refreshing = true
+	go b.refresh(set, channelID)
+}
+
+func (b *badgeCache) refresh(set *badgeSet, channelID string) {
+	ctx, cancel := context.WithTimeout(b.gCtx, time.Second*30)
+	defer cancel()
+
+	var (
+		sets []twitch.ChatBadgeSet
+		err  error
+	)
+	if channelID == "" {
+		sets, err = b.gCtx.Inst().Twitch.GetGlobalChatBadges(ctx)
+	} else {
+		sets, err = b.gCtx.Inst().Twitch.GetChannelChatBadges(ctx, channelID)
+	}
+
+	b.mtx.Lock()
+
+	set.refreshing = false
+	if err != nil {
+		set.expiresAt = time.Now().Add(b.retry)
+		b.mtx.Unlock()
+		logrus.WithField("channel", channelID).Warn("failed to get chat badges: ", err)
+		return
+	}
+
+	versions := map[string]map[string]twitch.ChatBadgeVersion{}
+	for _, s := range sets {
+		versions[s.SetID] = map[string]twitch.ChatBadgeVersion{}
+		for _, v := range s.Versions {
+			versions[s.SetID][v.ID] = v
+		}
+	}
+
+	set.versions = versions
+	set.expiresAt = time.Now().Add(b.ttl)
+	updates := b.backfill()
+	b.mtx.Unlock()
+
+	for _, u := range updates {
+		b.writer.Update(u)
+	}
+}
+
+// chatBadges resolves every badge of a message in the order twitch sent them.
+// Badges that cannot be resolved yet are stored with their set id as the name and without urls, the cache fills them in later.
+func chatBadges(cache *badgeCache, vodID primitive.ObjectID, roomID string, tags map[string]string, userBadges map[string]int) []structures.ChatBadge {
+	type badgeRef struct {
+		setID   string
+		version string
+	}
+
+	refs := []badgeRef{}
+	if raw := tags["badges"]; raw != "" {
+		for _, v := range strings.Split(raw, ",") {
+			splits := strings.SplitN(v, "/", 2)
+			if len(splits) != 2 {
+				continue
+			}
+
+			refs = append(refs, badgeRef{splits[0], splits[1]})
+		}
+	} else {
+		for setID, version := range userBadges {
+			refs = append(refs, badgeRef{setID, strconv.Itoa(version)})
+		}
+	}
+
+	badges := make([]structures.ChatBadge, 0, len(refs))
+	for _, ref := range refs {
+		badge := structures.ChatBadge{
+			Name:    ref.setID,
+			SetID:   ref.setID,
+			Version: ref.version,
+			URLs:    []string{},
+		}
+		if v, ok := cache.Resolve(roomID, ref.setID, ref.version, vodID); ok {
+			badge.Name = badgeName(v, ref.setID)
+			badge.URLs = badgeURLs(v)
+		}
+
+		badges = append(badges, badge)
+	}
+
+	return badges
+}
+
+func badgeName(v twitch.ChatBadgeVersion, setID string) string {
+	if v.Title == "" {
+		return setID
+	}
+
+	return v.Title
+}
+
+func badgeURLs(v twitch.ChatBadgeVersion) []string {
+	return []string{v.ImageURL1x, v.ImageURL2x, v.ImageURL4x}
+}
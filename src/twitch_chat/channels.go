@@ -0,0 +1,178 @@
+package twitch_chat
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/gempir/go-twitch-irc/v2"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UsersUpdatedEvent is the redis channel to publish on to make the chat ingester resync right away.
+// Writes to the users collection are picked up from its change stream, this is for anything that cannot rely on that.
+const UsersUpdatedEvent = "twitch-chat:users-updated"
+
+// channels keeps the set of joined twitch channels in sync with the users collection.
+type channels struct {
+	cl *twitch.Client
+
+	mtx     sync.RWMutex
+	users   map[string]primitive.ObjectID // twitch id -> user id
+	logins  map[string]string             // twitch id -> login
+	pending []string
+}
+
+func newChannels(cl *twitch.Client) *channels {
+	return &channels{
+		cl:     cl,
+		users:  map[string]primitive.ObjectID{},
+		logins: map[string]string{},
+	}
+}
+
+// User returns the user id for a twitch room id or a nil object id if we are not tracking the room.
+func (c *channels) User(roomID string) primitive.ObjectID {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.users[roomID]
+}
+
+// UserIDs returns the users of the joined channels.
+func (c *channels) UserIDs() []primitive.ObjectID {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	ids := make([]primitive.ObjectID, 0, len(c.users))
+	for _, id := range c.users {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// Sync parts channels which are no longer in the users collection and queues joins for new ones.
+func (c *channels) Sync(users []structures.User) {
+	nUsers := map[string]primitive.ObjectID{}
+	nLogins := map[string]string{}
+	for _, v := range users {
+		nUsers[v.Twitch.ID] = v.ID
+		nLogins[v.Twitch.ID] = strings.ToLower(v.Twitch.Login)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for id, login := range c.logins {
+		if nLogins[id] != login {
+			c.cl.Depart(login)
+		}
+	}
+
+	for id, login := range nLogins {
+		if c.logins[id] != login {
+			c.pending = append(c.pending, login)
+		}
+	}
+
+	c.users = nUsers
+	c.logins = nLogins
+}
+
+// RunJoiner joins queued channels one at a time, at most limit channels every 10 seconds.
+func (c *channels) RunJoiner(ctx context.Context, limit int) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	tick := time.NewTicker(time.Second * 10 / time.Duration(limit))
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		c.mtx.Lock()
+		if len(c.pending) == 0 {
+			c.mtx.Unlock()
+			continue
+		}
+
+		login := c.pending[0]
+		c.pending = c.pending[1:]
+		wanted := false
+		for _, v := range c.logins {
+			if v == login {
+				wanted = true
+				break
+			}
+		}
+		if wanted {
+			c.cl.Join(login)
+		}
+		c.mtx.Unlock()
+	}
+}
+
+func fetchUsers(gCtx global.Context) ([]structures.User, error) {
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*5)
+	defer cancel()
+
+	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionUsers).Find(ctx, bson.M{})
+	users := []structures.User{}
+	if err == nil {
+		err = cur.All(ctx, &users)
+	}
+
+	return users, err
+}
+
+// watchUsers signals on updates whenever the users collection changes, until the context is done.
+func watchUsers(gCtx global.Context, updates chan<- string) {
+	for {
+		if err := watch(gCtx, updates); err != nil && gCtx.Err() == nil {
+			logrus.Error("failed to watch users: ", err)
+		}
+
+		select {
+		case <-gCtx.Done():
+			return
+		case <-time.After(time.Second * 5):
+		}
+
+		// changes may have been missed while the stream was down
+		notify(updates)
+	}
+}
+
+func watch(gCtx global.Context, updates chan<- string) error {
+	cs, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameUsers).Watch(gCtx, []bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cs.Close(context.Background())
+
+	for cs.Next(gCtx) {
+		notify(updates)
+	}
+
+	return cs.Err()
+}
+
+func notify(updates chan<- string) {
+	select {
+	case updates <- UsersUpdatedEvent:
+	default:
+		// a resync is pending already
+	}
+}
@@ -0,0 +1,84 @@
+package twitch_chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	twitchapi "github.com/AdmiralBulldogTv/VodApi/src/twitch"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type formatRequest struct {
+	emoteID string
+	vodID   primitive.ObjectID
+}
+
+// formatResolver looks up the formats of twitch emotes in the background and sets them on the messages of the vod that used them.
+type formatResolver struct {
+	formats *twitchapi.EmoteFormats
+	writer  *chatWriter
+	queue   chan formatRequest
+}
+
+func newFormatResolver(gCtx global.Context, writer *chatWriter) *formatResolver {
+	r := &formatResolver{
+		formats: twitchapi.NewEmoteFormats(10000, time.Hour*24),
+		writer:  writer,
+		queue:   make(chan formatRequest, 1000),
+	}
+
+	go r.run(gCtx)
+
+	return r
+}
+
+// Format returns the format of an emote when it is known, otherwise it is looked up and set on the messages of the vod later.
+func (r *formatResolver) Format(emoteID string, vodID primitive.ObjectID) (twitchapi.EmoteFormat, bool) {
+	if format, ok := r.formats.Cached(emoteID); ok {
+		return format, true
+	}
+
+	select {
+	case r.queue <- formatRequest{emoteID: emoteID, vodID: vodID}:
+	default:
+		// the messages keep urls that work for either format
+	}
+
+	return "", false
+}
+
+func (r *formatResolver) run(gCtx global.Context) {
+	for {
+		select {
+		case <-gCtx.Done():
+			return
+		case req := <-r.queue:
+			ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
+			format, err := r.formats.Get(ctx, req.emoteID)
+			cancel()
+			if err != nil {
+				logrus.WithField("emote_id", req.emoteID).Warn("failed to get emote format: ", err)
+				continue
+			}
+
+			r.writer.Update(chatUpdate{
+				filter: bson.M{
+					"vod_id":               req.vodID,
+					"chat_emote.twitch_id": req.emoteID,
+				},
+				update: bson.M{
+					"$set": bson.M{
+						"chat_emote.$[e].format": format,
+					},
+				},
+				arrayFilters: []interface{}{bson.M{
+					"e.twitch_id": req.emoteID,
+					"e.format":    bson.M{"$exists": false},
+				}},
+			})
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package twitch_chat
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// liveVods holds the live vod of every joined channel, it is refreshed in the background so chat never waits on redis.
+type liveVods struct {
+	mtx  sync.RWMutex
+	vods map[primitive.ObjectID]primitive.ObjectID // user id -> vod id
+}
+
+func newLiveVods() *liveVods {
+	return &liveVods{
+		vods: map[primitive.ObjectID]primitive.ObjectID{},
+	}
+}
+
+// Get returns the vod that is live for the user, false when the user is not live.
+func (l *liveVods) Get(uID primitive.ObjectID) (primitive.ObjectID, bool) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	vid, ok := l.vods[uID]
+	return vid, ok
+}
+
+// Run refreshes the live vods of the joined channels every 2 seconds until the context is done,
+// chat of a channel that just went live is dropped until then.
+func (l *liveVods) Run(gCtx global.Context, joined *channels) {
+	tick := time.NewTicker(time.Second * 2)
+	defer tick.Stop()
+
+	for {
+		if err := l.refresh(gCtx, joined.UserIDs()); err != nil {
+			logrus.Warn("failed to check live channels: ", err)
+		}
+
+		select {
+		case <-gCtx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (l *liveVods) refresh(gCtx global.Context, userIDs []primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(gCtx, time.Second*5)
+	defer cancel()
+
+	pipe := gCtx.Inst().Redis.Pipeline(ctx)
+	cmds := make([]*redis.StringCmd, len(userIDs))
+	for i, uID := range userIDs {
+		cmds[i] = pipe.Get(ctx, "streamer-live:"+uID.Hex())
+	}
+	// channels that are not live return redis.Nil
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+
+	vods := map[primitive.ObjectID]primitive.ObjectID{}
+	for i, cmd := range cmds {
+		get, err := cmd.Result()
+		if err != nil {
+			continue
+		}
+
+		vid, err := primitive.ObjectIDFromHex(get)
+		if err != nil {
+			logrus.Warn("bad vod id in redis: ", err)
+			continue
+		}
+
+		vods[userIDs[i]] = vid
+	}
+
+	l.mtx.Lock()
+	l.vods = vods
+	l.mtx.Unlock()
+
+	return nil
+}
@@ -1,242 +1,140 @@
 package twitch_chat
 
 import (
-	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/AdmiralBulldogTv/VodApi/src/emotes"
 	"github.com/AdmiralBulldogTv/VodApi/src/global"
 	"github.com/AdmiralBulldogTv/VodApi/src/structures"
-	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	twitchapi "github.com/AdmiralBulldogTv/VodApi/src/twitch"
 	"github.com/gempir/go-twitch-irc/v2"
-	"github.com/go-redis/redis/v8"
-	jsoniter "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var json = jsoniter.ConfigCompatibleWithStandardLibrary
-
 func New(gCtx global.Context) <-chan struct{} {
 	done := make(chan struct{})
 
-	ctx, cancel := context.WithTimeout(gCtx, time.Second*5)
-	cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionUsers).Find(ctx, bson.M{})
-	cancel()
-	users := []structures.User{}
-	if err == nil {
-		err = cur.All(ctx, &users)
-	}
+	users, err := fetchUsers(gCtx)
 	if err != nil {
 		logrus.Fatal("failed to fetch users: ", err)
 	}
 
 	cl := twitch.NewAnonymousClient()
+	joined := newChannels(cl)
+	joined.Sync(users)
+
+	go joined.RunJoiner(gCtx, gCtx.Config().TwitchChat.JoinRateLimit)
+
+	writer := newChatWriter(gCtx)
+
+	live := newLiveVods()
+	go live.Run(gCtx, joined)
+
+	registry := emotes.NewRegistry(gCtx)
+	configureEmotes(registry, users)
+
+	formats := newFormatResolver(gCtx, writer)
+
+	badges := newBadgeCache(gCtx, writer)
 	for _, v := range users {
-		cl.Join(v.Twitch.Login)
+		badges.Warm(v.Twitch.ID)
 	}
 
-	userMp := map[string]primitive.ObjectID{}
-
 	go func() {
+		updates := make(chan string, 10)
+		gCtx.Inst().Redis.Subscribe(gCtx, updates, UsersUpdatedEvent)
+		go watchUsers(gCtx, updates)
+
 		for {
-			ctx, cancel := context.WithTimeout(gCtx, time.Second*5)
-			cur, err := gCtx.Inst().Mongo.Collection(mongo.CollectionUsers).Find(ctx, bson.M{})
-			cancel()
-			users := []structures.User{}
-			if err == nil {
-				err = cur.All(ctx, &users)
+			select {
+			case <-gCtx.Done():
+				return
+			case <-updates:
+			case <-time.After(time.Minute * 30):
 			}
+
+			users, err := fetchUsers(gCtx)
 			if err != nil {
-				logrus.Fatal("failed to fetch users: ", err)
+				logrus.Error("failed to fetch users: ", err)
+				continue
 			}
 
-			nMp := map[string]primitive.ObjectID{}
-			cl := twitch.NewAnonymousClient()
+			joined.Sync(users)
+			configureEmotes(registry, users)
 			for _, v := range users {
-				cl.Join(v.Twitch.Login)
-				nMp[v.Twitch.ID] = v.ID
-			}
-			userMp = nMp
-			select {
-			case <-gCtx.Done():
-				return
-			case <-time.After(time.Minute * 30):
+				badges.Warm(v.Twitch.ID)
 			}
 		}
 	}()
 
 	cl.OnPrivateMessage(func(message twitch.PrivateMessage) {
-		uID := userMp[message.RoomID]
+		uID := joined.User(message.RoomID)
 		if uID.IsZero() {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
-		defer cancel()
-		pipe := gCtx.Inst().Redis.Pipeline(ctx)
-		setNxCmd := pipe.SetNX(ctx, "twitch-chat-msg:"+message.ID, "1", time.Second*30)
-		getCmd := pipe.Get(ctx, "streamer-live:"+uID.Hex())
-		_, _ = pipe.Exec(ctx)
-		set, err := setNxCmd.Result()
-		if err != nil {
-			logrus.Warn("failed to check deleted messages: ", err)
-			return
-		}
-		if !set {
+		vid, ok := live.Get(uID)
+		if !ok {
 			return
 		}
+		gCtx.Inst().Prometheus.TwitchChatMessages().Observe(1)
 
-		get, err := getCmd.Result()
-		if err != nil {
-			if err == redis.Nil {
-				return
-			}
+		writer.Write(structures.Chat{
+			VodID: vid,
+			Type:  structures.ChatTypeMessage,
+			Twitch: structures.ChatTwitch{
+				ID:          message.ID,
+				UserID:      message.User.ID,
+				Login:       message.User.Name,
+				DisplayName: message.User.DisplayName,
+				Color:       message.User.Color,
+			},
+			Timestamp: message.Time,
+			Content:   message.Message,
+			Emotes:    chatEmotes(registry, formats, vid, message.RoomID, message.Message, message.Emotes),
+			Badges:    chatBadges(badges, vid, message.RoomID, message.Tags, message.User.Badges),
+		})
+	})
 
-			logrus.Warn("failed to check live channel: ", err)
+	cl.OnUserNoticeMessage(func(message twitch.UserNoticeMessage) {
+		uID := joined.User(message.RoomID)
+		if uID.IsZero() {
 			return
 		}
 
-		vid, err := primitive.ObjectIDFromHex(get)
-		if err != nil {
-			logrus.Warn("bad vod id in redis: ", err)
+		vid, ok := live.Get(uID)
+		if !ok {
 			return
 		}
-
-		emoteMp := map[string]emotes.Emote{}
-
-		ctx, cancel = context.WithTimeout(gCtx, time.Second*5)
-		defer cancel()
-		ffzEmotes, err := emotes.GetFFZ(gCtx, ctx, message.RoomID)
-		if err != nil {
-			logrus.Debug("failed to get ffz emotes: ", err)
-		}
-
-		for _, v := range ffzEmotes {
-			emoteMp[v.Name] = v
-		}
-
-		ctx, cancel = context.WithTimeout(gCtx, time.Second*5)
-		defer cancel()
-		bttvEmotes, err := emotes.GetBttv(gCtx, ctx, message.RoomID)
-		if err != nil {
-			logrus.Debug("failed to get bttv emotes: ", err)
-		}
-
-		for _, v := range bttvEmotes {
-			emoteMp[v.Name] = v
-		}
-
-		ctx, cancel = context.WithTimeout(gCtx, time.Second*5)
-		defer cancel()
-		seventvEmotes, err := emotes.Get7TV(gCtx, ctx, message.RoomID)
-		if err != nil {
-			logrus.Debug("failed to get 7tv emotes: ", err)
+		gCtx.Inst().Prometheus.TwitchChatMessages().Observe(1)
+
+		notice := &structures.ChatUserNotice{
+			Kind:             structures.ChatUserNoticeKindFromMsgID(message.MsgID),
+			MsgID:            message.MsgID,
+			SystemMessage:    message.SystemMsg,
+			CumulativeMonths: msgParamInt(message.MsgParams, "msg-param-cumulative-months"),
+			StreakMonths:     msgParamInt(message.MsgParams, "msg-param-streak-months"),
+			SubPlan:          message.MsgParams["msg-param-sub-plan"],
+			GiftCount:        giftCount(message.MsgID, message.MsgParams),
+			SenderGiftCount:  msgParamInt(message.MsgParams, "msg-param-sender-count"),
+			GiftMonths:       msgParamInt(message.MsgParams, "msg-param-gift-months"),
+			RaidViewerCount:  msgParamInt(message.MsgParams, "msg-param-viewerCount"),
 		}
-
-		for _, v := range seventvEmotes {
-			emoteMp[v.Name] = v
-		}
-
-		emotes := map[string]structures.ChatEmote{}
-
-		for _, v := range message.Emotes {
-			emotes[v.Name] = structures.ChatEmote{
-				Name: v.Name,
-				URLs: []string{
-					fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v1/%s/1.0", v.ID),
-					fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v1/%s/2.0", v.ID),
-					fmt.Sprintf("https://static-cdn.jtvnw.net/emoticons/v1/%s/3.0", v.ID),
-				},
+		if id := message.MsgParams["msg-param-recipient-id"]; id != "" {
+			notice.Recipient = &structures.ChatUserNoticeRecipient{
+				UserID:      id,
+				Login:       message.MsgParams["msg-param-recipient-user-name"],
+				DisplayName: message.MsgParams["msg-param-recipient-display-name"],
 			}
 		}
 
-		badges := []structures.ChatBadge{}
-		if message.User.Badges["broadcaster"] != 0 {
-			badges = append(badges, structures.ChatBadge{
-				Name: "Broadcaster",
-				URLs: []string{
-					"https://static-cdn.jtvnw.net/chat-badges/broadcaster.png",
-				},
-			})
-		}
-
-		if message.User.Badges["moderator"] != 0 {
-			badges = append(badges, structures.ChatBadge{
-				Name: "Moderator",
-				URLs: []string{
-					"https://static-cdn.jtvnw.net/badges/v1/3267646d-33f0-4b17-b3df-f923a41db1d0/1",
-					"https://static-cdn.jtvnw.net/badges/v1/3267646d-33f0-4b17-b3df-f923a41db1d0/2",
-					"https://static-cdn.jtvnw.net/badges/v1/3267646d-33f0-4b17-b3df-f923a41db1d0/3",
-				},
-			})
-		}
-
-		if message.User.Badges["vip"] != 0 {
-			badges = append(badges, structures.ChatBadge{
-				Name: "VIP",
-				URLs: []string{
-					"https://static-cdn.jtvnw.net/badges/v1/b817aba4-fad8-49e2-b88a-7cc744dfa6ec/1",
-					"https://static-cdn.jtvnw.net/badges/v1/b817aba4-fad8-49e2-b88a-7cc744dfa6ec/2",
-					"https://static-cdn.jtvnw.net/badges/v1/b817aba4-fad8-49e2-b88a-7cc744dfa6ec/3",
-				},
-			})
-		}
-
-		if message.User.Badges["staff"] != 0 {
-			badges = append(badges, structures.ChatBadge{
-				Name: "Staff",
-				URLs: []string{},
-			})
-		}
-
-		if message.User.Badges["partner"] != 0 {
-			badges = append(badges, structures.ChatBadge{
-				Name: "Partner",
-				URLs: []string{
-					"https://static-cdn.jtvnw.net/badges/v1/d12a2e27-16f6-41d0-ab77-b780518f00a3/1",
-					"https://static-cdn.jtvnw.net/badges/v1/d12a2e27-16f6-41d0-ab77-b780518f00a3/2",
-					"https://static-cdn.jtvnw.net/badges/v1/d12a2e27-16f6-41d0-ab77-b780518f00a3/3",
-				},
-			})
-		}
-
-		if message.User.Badges["subscriber"] != 0 {
-			badges = append(badges, structures.ChatBadge{
-				Name: fmt.Sprintf("Subscriber (%d months)", message.User.Badges["subscriber"]),
-				URLs: []string{
-					"https://static-cdn.jtvnw.net/badges/v1/5d9f2208-5dd8-11e7-8513-2ff4adfae661/1",
-					"https://static-cdn.jtvnw.net/badges/v1/5d9f2208-5dd8-11e7-8513-2ff4adfae661/2",
-					"https://static-cdn.jtvnw.net/badges/v1/5d9f2208-5dd8-11e7-8513-2ff4adfae661/3",
-				},
-			})
-		}
-
-		splits := strings.Split(message.Message, " ")
-		for _, v := range splits {
-			if e, ok := emoteMp[v]; ok {
-				emotes[v] = structures.ChatEmote{
-					Name:      v,
-					URLs:      e.URLs,
-					ZeroWidth: e.ZeroWidth,
-				}
-			}
-		}
-
-		uniqueEmotes := make([]structures.ChatEmote, len(emotes))
-		i := 0
-		for _, v := range emotes {
-			uniqueEmotes[i] = v
-			i++
-		}
-
-		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).InsertOne(ctx, structures.Chat{
+		writer.Write(structures.Chat{
 			VodID: vid,
+			Type:  structures.ChatTypeUserNotice,
 			Twitch: structures.ChatTwitch{
 				ID:          message.ID,
 				UserID:      message.User.ID,
@@ -244,69 +142,78 @@ func New(gCtx global.Context) <-chan struct{} {
 				DisplayName: message.User.DisplayName,
 				Color:       message.User.Color,
 			},
-			Timestamp: message.Time,
-			Content:   message.Message,
-			Emotes:    uniqueEmotes,
-			Badges:    badges,
-		}); err != nil {
-			logrus.Error("failed to insert message into chat: ", err)
-		}
+			Timestamp:  message.Time,
+			Content:    message.Message,
+			Emotes:     chatEmotes(registry, formats, vid, message.RoomID, message.Message, message.Emotes),
+			Badges:     chatBadges(badges, vid, message.RoomID, message.Tags, message.User.Badges),
+			UserNotice: notice,
+		})
 	})
 
 	cl.OnClearChatMessage(func(message twitch.ClearChatMessage) {
-		uID := userMp[message.RoomID]
-		if uID.IsZero() || message.TargetUserID == "" {
+		uID := joined.User(message.RoomID)
+		if uID.IsZero() {
 			return
 		}
 
-		h := sha256.New()
-		data, _ := json.Marshal(message)
-		h.Write(data)
-
-		ctx, cancel := context.WithTimeout(gCtx, time.Second*10)
-		defer cancel()
-		pipe := gCtx.Inst().Redis.Pipeline(ctx)
-		setNxCmd := pipe.SetNX(ctx, "twitch-clear-msg:"+hex.EncodeToString(h.Sum(nil)), "1", time.Second*30)
-		getCmd := pipe.Get(ctx, "streamer-live:"+uID.Hex())
-		_, _ = pipe.Exec(ctx)
-		set, err := setNxCmd.Result()
-		if err != nil {
-			logrus.Warn("failed to check deleted messages: ", err)
-			return
-		}
-		if !set {
+		vid, ok := live.Get(uID)
+		if !ok {
 			return
 		}
 
-		get, err := getCmd.Result()
-		if err != nil {
-			if err == redis.Nil {
-				return
+		filter := bson.M{
+			"vod_id":    vid,
+			"timestamp": bson.M{"$lte": message.Time},
+		}
+		deleted := structures.ChatDeleted{
+			Reason:    structures.ChatDeletedReasonClear,
+			Timestamp: message.Time,
+		}
+		if message.TargetUserID != "" {
+			filter["twitch.user_id"] = message.TargetUserID
+			if message.BanDuration == 0 {
+				deleted.Reason = structures.ChatDeletedReasonBan
+			} else {
+				deleted.Reason = structures.ChatDeletedReasonTimeout
+				deleted.Duration = message.BanDuration
 			}
+		}
+
+		writer.Clear(filter, deleted)
+	})
 
-			logrus.Warn("failed to check live channel: ", err)
+	cl.OnClearMessage(func(message twitch.ClearMessage) {
+		uID := joined.User(message.Tags["room-id"])
+		if uID.IsZero() || message.TargetMsgID == "" {
 			return
 		}
 
-		vid, err := primitive.ObjectIDFromHex(get)
-		if err != nil {
-			logrus.Warn("bad vod id in redis: ", err)
+		vid, ok := live.Get(uID)
+		if !ok {
 			return
 		}
 
-		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).DeleteMany(ctx, bson.M{
-			"vod_id":         vid,
-			"twitch.user_id": message.TargetUserID,
-		}); err != nil {
-			logrus.Error("failed to insert message into chat: ", err)
+		ts := time.Now()
+		if ms, err := strconv.ParseInt(message.Tags["tmi-sent-ts"], 10, 64); err == nil {
+			ts = time.Unix(0, ms*int64(time.Millisecond))
 		}
+
+		writer.Clear(bson.M{
+			"vod_id":    vid,
+			"twitch.id": message.TargetMsgID,
+		}, structures.ChatDeleted{
+			Reason:    structures.ChatDeletedReasonDelete,
+			Timestamp: ts,
+		})
 	})
 
 	go func() {
 		defer close(done)
-		if err := cl.Connect(); err != nil {
+		if err := cl.Connect(); err != nil && err != twitch.ErrClientDisconnected {
 			logrus.Fatal("failed to connect to twitch: ", err)
 		}
+
+		writer.Close()
 	}()
 
 	go func() {
@@ -316,3 +223,84 @@ func New(gCtx global.Context) <-chan struct{} {
 
 	return done
 }
+
+func configureEmotes(registry *emotes.Registry, users []structures.User) {
+	for _, v := range users {
+		var precedence []emotes.EmoteProviderName
+		if names := v.Settings.Emotes.EnabledProviders(); names != nil {
+			precedence = make([]emotes.EmoteProviderName, 0, len(names))
+			for _, name := range names {
+				// settings written before they were validated may name providers that do not exist
+				p, ok := emotes.ParseProviderName(name)
+				if !ok {
+					logrus.WithField("user_id", v.ID.Hex()).Warn("unknown emote provider: ", name)
+					continue
+				}
+
+				precedence = append(precedence, p)
+			}
+		}
+
+		registry.Configure(v.Twitch.ID, precedence)
+	}
+}
+
+func chatEmotes(registry *emotes.Registry, formats *formatResolver, vodID primitive.ObjectID, roomID string, content string, twitchEmotes []*twitch.Emote) []structures.ChatEmote {
+	emoteMp := registry.Get(roomID)
+
+	mp := map[string]structures.ChatEmote{}
+
+	for _, v := range twitchEmotes {
+		// the default format serves whichever version the emote has, the format is set once it is known
+		format, ok := formats.Format(v.ID, vodID)
+		urlFormat := format
+		if !ok {
+			urlFormat = twitchapi.EmoteFormatDefault
+		}
+
+		mp[v.Name] = structures.ChatEmote{
+			Name:      v.Name,
+			TwitchID:  v.ID,
+			URLs:      twitchapi.EmoteURLs(v.ID, urlFormat, twitchapi.EmoteThemeDark),
+			LightURLs: twitchapi.EmoteURLs(v.ID, urlFormat, twitchapi.EmoteThemeLight),
+			Format:    string(format),
+		}
+	}
+
+	splits := strings.Split(content, " ")
+	for _, v := range splits {
+		if e, ok := emoteMp[v]; ok {
+			mp[v] = structures.ChatEmote{
+				Name:      v,
+				URLs:      e.URLs,
+				ZeroWidth: e.ZeroWidth,
+			}
+		}
+	}
+
+	uniqueEmotes := make([]structures.ChatEmote, len(mp))
+	i := 0
+	for _, v := range mp {
+		uniqueEmotes[i] = v
+		i++
+	}
+
+	return uniqueEmotes
+}
+
+func msgParamInt(params map[string]string, key string) int {
+	i, _ := strconv.Atoi(params[key])
+	return i
+}
+
+// giftCount is the number of subs a notice gifts, only mystery gifts carry it.
+func giftCount(msgID string, params map[string]string) int {
+	switch msgID {
+	case "submysterygift", "anonsubmysterygift":
+		return msgParamInt(params, "msg-param-mass-gift-count")
+	case "subgift", "anonsubgift":
+		return 1
+	}
+
+	return 0
+}
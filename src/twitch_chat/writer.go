@@ -0,0 +1,225 @@
+package twitch_chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chatOp is either a message to insert or an update to apply, ops are applied in the order they were queued.
+type chatOp struct {
+	msg    structures.Chat
+	update *chatUpdate
+}
+
+// chatUpdate is applied to every message matching the filter.
+type chatUpdate struct {
+	filter       bson.M
+	update       bson.M
+	arrayFilters []interface{}
+}
+
+// chatWriter batches chat inserts so the irc read loop never waits on mongo or redis.
+type chatWriter struct {
+	gCtx global.Context
+
+	queue         chan chatOp
+	flushSize     int
+	flushInterval time.Duration
+	blockTimeout  time.Duration
+
+	closing chan struct{}
+	stopped chan struct{}
+}
+
+func newChatWriter(gCtx global.Context) *chatWriter {
+	cfg := gCtx.Config().TwitchChat.Writer
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 10000
+	}
+
+	flushSize := cfg.FlushSize
+	if flushSize <= 0 {
+		flushSize = 500
+	}
+
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+
+	w := &chatWriter{
+		gCtx:          gCtx,
+		queue:         make(chan chatOp, queueSize),
+		flushSize:     flushSize,
+		flushInterval: flushInterval,
+		blockTimeout:  time.Millisecond * 100,
+		closing:       make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Write queues a message to be inserted, the unique index on the twitch id keeps out the copies of other ingesters.
+func (w *chatWriter) Write(msg structures.Chat) {
+	w.enqueue(chatOp{msg: msg})
+}
+
+// Update queues an update, it is applied after the messages that were queued before it are inserted.
+func (w *chatWriter) Update(update chatUpdate) {
+	w.enqueue(chatOp{update: &update})
+}
+
+// Clear marks the messages matching the filter as deleted unless they were deleted already.
+func (w *chatWriter) Clear(filter bson.M, deleted structures.ChatDeleted) {
+	filter["deleted"] = bson.M{"$exists": false}
+
+	w.Update(chatUpdate{
+		filter: filter,
+		update: bson.M{
+			"$set": bson.M{
+				"deleted": deleted,
+			},
+		},
+	})
+}
+
+// enqueue waits briefly when the queue is full and then drops the op.
+func (w *chatWriter) enqueue(op chatOp) {
+	defer w.gCtx.Inst().Prometheus.TwitchChatQueueLength().Set(float64(len(w.queue)))
+
+	select {
+	case w.queue <- op:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(w.blockTimeout)
+	defer timer.Stop()
+
+	select {
+	case w.queue <- op:
+	case <-timer.C:
+		w.gCtx.Inst().Prometheus.TwitchChatDroppedMessages().Inc()
+		if op.update != nil {
+			logrus.Warn("chat queue is full, dropping update")
+		} else {
+			logrus.Warn("chat queue is full, dropping message: ", op.msg.Twitch.ID)
+		}
+	}
+}
+
+// Close stops the writer and waits until the queue has been drained.
+func (w *chatWriter) Close() {
+	close(w.closing)
+	<-w.stopped
+}
+
+func (w *chatWriter) run() {
+	defer close(w.stopped)
+
+	tick := time.NewTicker(w.flushInterval)
+	defer tick.Stop()
+
+	buf := make([]chatOp, 0, w.flushSize)
+	flush := func() {
+		if len(buf) == 0 {
+			return
+		}
+
+		// we use a fresh context so that the final flush still happens while shutting down
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		start := time.Now()
+		docs := make([]interface{}, len(buf))
+		for i, op := range buf {
+			docs[i] = op.msg
+		}
+		if _, err := w.gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); insertErr(err) != nil {
+			logrus.Errorf("failed to insert %d messages into chat: %s", len(docs), err.Error())
+		}
+		w.gCtx.Inst().Prometheus.TwitchChatFlushDurationMilliseconds().Observe(float64(time.Since(start)/time.Microsecond) / 1000)
+		w.gCtx.Inst().Prometheus.TwitchChatFlushSize().Observe(float64(len(docs)))
+
+		buf = make([]chatOp, 0, w.flushSize)
+	}
+	apply := func(op chatOp) {
+		if op.update == nil {
+			buf = append(buf, op)
+			if len(buf) >= w.flushSize {
+				flush()
+			}
+			return
+		}
+
+		// the messages it targets may still be in the buffer
+		flush()
+		w.apply(*op.update)
+	}
+	drain := func() {
+		for {
+			select {
+			case op := <-w.queue:
+				apply(op)
+			default:
+				w.gCtx.Inst().Prometheus.TwitchChatQueueLength().Set(0)
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case op := <-w.queue:
+			apply(op)
+		case <-tick.C:
+			flush()
+		case <-w.closing:
+			drain()
+			flush()
+			return
+		}
+	}
+}
+
+// insertErr drops the errors of messages another ingester inserted first.
+func insertErr(err error) error {
+	bwe, ok := err.(mongo.BulkWriteException)
+	if !ok || bwe.WriteConcernError != nil {
+		return err
+	}
+
+	for _, e := range bwe.WriteErrors {
+		if e.Code != mongo.ErrCodeDuplicateKey {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *chatWriter) apply(update chatUpdate) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	opts := options.Update()
+	if len(update.arrayFilters) != 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: update.arrayFilters})
+	}
+
+	if _, err := w.gCtx.Inst().Mongo.Collection(mongo.CollectionNameChat).UpdateMany(ctx, update.filter, update.update, opts); err != nil {
+		logrus.Error("failed to update chat messages: ", err)
+	}
+}
@@ -0,0 +1,119 @@
+package vods
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/global"
+	"github.com/AdmiralBulldogTv/VodApi/src/outbox"
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+	"github.com/AdmiralBulldogTv/VodApi/src/svc/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrBadTransition is returned when the vod is not in a state it can leave for the new one,
+// either because the transition is not allowed or because the vod moved on since it was read.
+var ErrBadTransition = errors.New("vod state does not allow this")
+
+var transitions = map[structures.VodState][]structures.VodState{
+	structures.VodStateLive:       {structures.VodStateQueued},
+	structures.VodStateQueued:     {structures.VodStateProcessing, structures.VodStateReady, structures.VodStateFailed, structures.VodStateCanceled},
+	structures.VodStateProcessing: {structures.VodStateReady, structures.VodStateFailed, structures.VodStateCanceled},
+	structures.VodStateReady:      {structures.VodStateStorage},
+	structures.VodStateFailed:     {structures.VodStateQueued, structures.VodStateCanceled},
+	structures.VodStateCanceled:   {structures.VodStateQueued},
+}
+
+// CanTransition reports whether a vod may move from one state to the other.
+func CanTransition(from structures.VodState, to structures.VodState) bool {
+	for _, v := range transitions[from] {
+		if v == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Change struct {
+	Actor  structures.VodEventActor
+	Reason string
+	// Set is applied in the same update as the state
+	Set bson.M
+	// Messages are written to the outbox in the same transaction
+	Messages []structures.OutboxMessage
+}
+
+// Transition moves a vod from one state to another and records it in the vod events.
+// The update only applies while the vod is still in the state it is moved from.
+// The event and the messages of the change are written in the same transaction as the state.
+func Transition(gCtx global.Context, ctx context.Context, vodID primitive.ObjectID, from structures.VodState, to structures.VodState, change Change) error {
+	if !CanTransition(from, to) {
+		return ErrBadTransition
+	}
+
+	set := bson.M{}
+	for k, v := range change.Set {
+		set[k] = v
+	}
+	set["vod_state"] = to
+
+	err := mongo.Transaction(ctx, gCtx.Inst().Mongo, func(ctx context.Context) error {
+		res, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).UpdateOne(ctx, bson.M{
+			"_id":       vodID,
+			"vod_state": from,
+		}, bson.M{
+			"$set": set,
+		})
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			return ErrBadTransition
+		}
+
+		if _, err := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVodEvents).InsertOne(ctx, structures.VodEvent{
+			VodID:     vodID,
+			From:      from,
+			To:        to,
+			Actor:     change.Actor,
+			Reason:    change.Reason,
+			Timestamp: time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		return outbox.Add(gCtx, ctx, change.Messages...)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(change.Messages) != 0 {
+		outbox.Notify()
+	}
+
+	return nil
+}
+
+// System is the actor of changes the api makes on its own.
+func System() structures.VodEventActor {
+	return structures.VodEventActor{
+		Type: structures.VodEventActorSystem,
+	}
+}
+
+func Get(gCtx global.Context, ctx context.Context, vodID primitive.ObjectID) (structures.Vod, error) {
+	vod := structures.Vod{}
+	res := gCtx.Inst().Mongo.Collection(mongo.CollectionNameVods).FindOne(ctx, bson.M{
+		"_id": vodID,
+	})
+	err := res.Err()
+	if err == nil {
+		err = res.Decode(&vod)
+	}
+
+	return vod, err
+}
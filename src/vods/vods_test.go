@@ -0,0 +1,39 @@
+package vods
+
+import (
+	"testing"
+
+	"github.com/AdmiralBulldogTv/VodApi/src/structures"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from structures.VodState
+		to   structures.VodState
+		want bool
+	}{
+		{structures.VodStateLive, structures.VodStateQueued, true},
+		{structures.VodStateLive, structures.VodStateReady, false},
+		{structures.VodStateLive, structures.VodStateCanceled, false},
+		{structures.VodStateQueued, structures.VodStateProcessing, true},
+		{structures.VodStateQueued, structures.VodStateReady, true},
+		{structures.VodStateQueued, structures.VodStateCanceled, true},
+		{structures.VodStateQueued, structures.VodStateLive, false},
+		{structures.VodStateProcessing, structures.VodStateFailed, true},
+		{structures.VodStateProcessing, structures.VodStateQueued, false},
+		{structures.VodStateReady, structures.VodStateStorage, true},
+		{structures.VodStateReady, structures.VodStateQueued, false},
+		{structures.VodStateFailed, structures.VodStateQueued, true},
+		{structures.VodStateFailed, structures.VodStateReady, false},
+		{structures.VodStateCanceled, structures.VodStateQueued, true},
+		{structures.VodStateCanceled, structures.VodStateProcessing, false},
+		{structures.VodStateStorage, structures.VodStateReady, false},
+		{structures.VodStateQueued, structures.VodStateQueued, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}